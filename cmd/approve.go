@@ -0,0 +1,95 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// approveCmd represents the approve command
+var approveCmd = &cobra.Command{
+	Use:   "approve <accessor>",
+	Short: "Approve another user's breakglass request",
+	Long: `Some vault paths are protected by a control group, which means a second
+person has to approve access to them. When breakglass asks for approval it
+prints an accessor, which the approver passes to this command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No accessor specified. See --help")
+		}
+
+		accessor := args[0]
+
+		// get vault client
+		client := getVaultClient()
+
+		// show the approver what they are about to approve
+		status, err := controlGroupStatus(client, accessor)
+
+		if err != nil {
+			log.Fatal("Error looking up request: ", err)
+		}
+
+		log.WithFields(log.Fields{"accessor": accessor,
+			"path":     status.RequestPath,
+			"approved": status.Approved}).Debug("control group request")
+
+		fmt.Printf("Request for %s by %s\n", status.RequestPath, status.RequestEntity.Name)
+
+		_, err = client.Logical().Write("sys/control-group/authorize", map[string]interface{}{
+			"accessor": accessor,
+		})
+
+		if err != nil {
+			log.Fatal("Error approving request: ", err)
+		}
+
+		// check again, more than one approval may be required
+		status, err = controlGroupStatus(client, accessor)
+
+		if err != nil {
+			log.Fatal("Error looking up request: ", err)
+		}
+
+		if status.Approved {
+			log.Info("Request approved")
+		} else {
+			log.Info("Your approval has been recorded, but further approvals are required")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(approveCmd)
+}
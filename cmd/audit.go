@@ -0,0 +1,104 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// auditEntry is a line in the local audit log. It records what was asked
+// for, never the secret itself
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Vault     string    `json:"vault"`
+	User      string    `json:"user"`
+	Operation string    `json:"operation"`
+	Path      string    `json:"path"`
+	LeaseID   string    `json:"lease_id,omitempty"`
+	Wrapped   bool      `json:"wrapped,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditFile returns the local audit log, which has a line for every
+// secret breakglass fetched
+func auditFile() (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".breakglass", "audit.log"), nil
+}
+
+// auditSecret adds a request for path to the audit log. Problems writing
+// the log are only logged, so they never get in the way of breaking glass
+func auditSecret(operation string, path string, secret *api.Secret, err error) {
+	entry := auditEntry{
+		Time:      time.Now(),
+		Vault:     viper.GetString("vault"),
+		User:      viper.GetString("username"),
+		Operation: operation,
+		Path:      path,
+	}
+
+	if secret != nil {
+		entry.LeaseID = secret.LeaseID
+		entry.Wrapped = secret.WrapInfo != nil
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	logPath, err := auditFile()
+
+	if err != nil {
+		log.Warn("Not writing audit log: ", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0700); err != nil {
+		log.Warn("Not writing audit log: ", err)
+		return
+	}
+
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+
+	if err != nil {
+		log.Warn("Not writing audit log: ", err)
+		return
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		log.Warn("Not writing audit log: ", err)
+	}
+}
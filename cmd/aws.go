@@ -22,11 +22,7 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"os/signal"
-	"runtime"
-	"sync"
-	"syscall"
+	"strings"
 	"time"
 
 	garbler "github.com/michaelbironneau/garbler/lib"
@@ -37,6 +33,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -47,6 +44,12 @@ import (
 var awsCreateLoginProfile bool
 var awsRole string
 
+// STS options
+var awsCredentialType string
+var awsRoleARN string
+var awsTTL string
+var awsSessionName string
+
 type AWSCredentialResp struct {
 	AccessKey     string `mapstructure:"access_key"`
 	SecretKey     string `mapstructure:"secret_key"`
@@ -55,10 +58,16 @@ type AWSCredentialResp struct {
 
 // awsCmd represents the aws command
 var awsCmd = &cobra.Command{
-	Use:   "aws",
+	Use:   "aws [-- command args...]",
 	Short: "Get temporary login credentials for aws",
 	Long: `Generates temporary credentials for an AWS account
-and returns a user name and password you can use to login`,
+and returns a user name and password you can use to login.
+
+By default an IAM user is created for you. Use --credential-type to get
+STS credentials instead, which are usable straight away.
+
+With --exec, or a command after --, the command is run with the credentials
+in its environment and they are revoked when it exits.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		debug = viper.GetBool("debug")
 		execConn = viper.GetBool("exec")
@@ -67,19 +76,60 @@ and returns a user name and password you can use to login`,
 			log.SetLevel(log.DebugLevel)
 		}
 
-		if awsRole == "" {
+		if awsRole == "" && !isInteractive() {
 			log.Fatal("No AWS role host specified. See --help")
 		}
 
+		if err := checkAWSCredentialFlags(); err != nil {
+			log.Fatal(err)
+		}
+
+		// STS credentials don't belong to an IAM user we could log in as
+		if awsCreateLoginProfile && awsCredentialType != "iam_user" {
+			log.Fatal("Login Profiles can only be created for iam_user credentials")
+		}
+
+		// only STS credentials can sign in to the console
+		if awsConsole && awsCredentialType == "iam_user" {
+			log.Fatal("--console needs STS credentials, use --credential-type assumed_role or federation_token")
+		}
+
+		if awsConsoleDuration > 0 && awsCredentialType != "assumed_role" {
+			log.Fatal("--console-duration can only be used with assumed_role credentials, use --ttl for federation tokens")
+		}
+
+		// --cleanup waits for Ctrl-C after writing a profile or creating a
+		// login profile, anything else would leave nothing to wait for
+		if awsCleanup && awsWriteProfile == "" && !awsCreateLoginProfile {
+			log.Fatal("--cleanup can only be used with --write-profile or --create-login-profile")
+		}
+
 		// Get a Vault client
 		client := getVaultClient()
 
+		if awsRole == "" {
+			awsRole = pickAWSRole(client)
+		}
+
+		// Make sure the role hands out credentials we can do what was asked
+		// with, before creating any
+		if awsCreateLoginProfile {
+			types := awsRoleCredentialTypes(client, awsRole)
+			if types != nil && !containsString(types, "iam_user") {
+				log.Fatal("Login Profiles can only be created for iam_user credentials, ", awsRole, " gives out ", strings.Join(types, ", "))
+			}
+		}
+
 		// Read new AWS credentials from Vault
 		log.Debug("Reading Vault role: ", awsRole)
-		secret, err := client.Logical().Read(awsRole)
+		secret, err := readAWSCredentials(client, awsRole)
 		if err != nil {
 			log.Fatal("Error getting credentials: ", err)
 		}
+		recordHistory("aws", awsRole)
+		if wrapped(secret) {
+			return
+		}
 		log.Debug("Vault LeaseID: ", secret.LeaseID)
 
 		// Decode Vault response
@@ -88,19 +138,95 @@ and returns a user name and password you can use to login`,
 			log.Fatal("Error parsing vault's credential response: ", err)
 		}
 
-		// Print credentials
-		fmt.Println("Your AWS Credentials are below:")
-		fmt.Println("access_key: ", response.AccessKey)
-		fmt.Println("secret_key: ", response.SecretKey)
-		fmt.Println("security_token: ", response.SecurityToken)
+		// Save what needs cleaning up before we need it, in case we're killed
+		var cleanup cleanupTask
+		if secret.LeaseID != "" && (execConn || len(args) > 0 || awsCreateLoginProfile || (awsCleanup && awsWriteProfile != "")) {
+			cleanup.LeaseID = secret.LeaseID
+			cleanup.ID = saveCleanup(cleanup)
+		}
+
+		// Run a command with the credentials, then get rid of them
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running command with AWS credentials")
+			env := []string{
+				"AWS_ACCESS_KEY_ID=" + response.AccessKey,
+				"AWS_SECRET_ACCESS_KEY=" + response.SecretKey,
+			}
+			if response.SecurityToken != "" {
+				env = append(env, "AWS_SESSION_TOKEN="+response.SecurityToken)
+			}
+			if region := viper.GetString("region"); region != "" {
+				env = append(env, "AWS_REGION="+region, "AWS_DEFAULT_REGION="+region)
+			}
+			// a new IAM user's key doesn't work straight away, and the command
+			// would fail with it
+			if response.SecurityToken == "" {
+				creds := credentials.NewStaticCredentials(response.AccessKey, response.SecretKey, "")
+				waitForIAMUser(iam.New(session.New(), aws.NewConfig().WithCredentials(creds)))
+			}
+			execSession(client, args, env, cleanup)
+		}
+
+		// Write credentials to the shared credentials file, or print them
+		var credsFile string
+		if awsWriteProfile != "" {
+			credsFile, err = awsCredentialsFile()
+			if err != nil {
+				log.Fatal("Could not find AWS credentials file: ", err)
+			}
+			if awsCleanup {
+				cleanup.CredentialsFile = credsFile
+				cleanup.Profile = awsWriteProfile
+				cleanup.ID = saveCleanup(cleanup)
+			}
+			var expires time.Time
+			if secret.LeaseDuration > 0 {
+				expires = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+			}
+			err = writeAWSProfile(credsFile, awsWriteProfile, response, expires, secret.LeaseID)
+			if err != nil {
+				log.Fatal("Error writing AWS profile: ", err)
+			}
+			fmt.Printf("Your AWS Credentials have been written to profile %s in %s\n", awsWriteProfile, credsFile)
+			fmt.Printf("Use them with: export AWS_PROFILE=%s\n", awsWriteProfile)
+		} else {
+			fmt.Println("Your AWS Credentials are below:")
+			fmt.Println("access_key: ", response.AccessKey)
+			fmt.Println("secret_key: ", response.SecretKey)
+			fmt.Println("security_token: ", response.SecurityToken)
+		}
+
+		// Sign in to the console with the STS credentials
+		if awsConsole {
+			signinURL, err := awsConsoleURL(viper.GetString("federation-url"), response, awsCredentialType, viper.GetString("console-destination"), awsConsoleDuration)
+			if err != nil {
+				log.Fatal("Error creating console sign in URL: ", err)
+			}
+			fmt.Println("Console sign in URL: ", signinURL)
+			if awsConsoleOpen {
+				if err := openBrowser(signinURL); err != nil {
+					log.Warn("Could not open browser: ", err)
+				}
+			}
+		}
 
 		// Quit unless we're creating a login profile
 		if !awsCreateLoginProfile {
+			// or need to remove the profile we wrote when we're done
+			if awsCleanup && awsWriteProfile != "" {
+				waitForInterrupt()
+				endSession(client, cleanup)
+			}
 			return
 		}
 
+		// STS credentials don't belong to an IAM user we could log in as
+		if response.SecurityToken != "" {
+			log.Fatal("Login Profiles can only be created for iam_user credentials")
+		}
+
 		// Set up AWS credentials
-		creds := credentials.NewStaticCredentials(response.AccessKey, response.SecretKey, "")
+		creds := credentials.NewStaticCredentials(response.AccessKey, response.SecretKey, response.SecurityToken)
 		_, err = creds.Get()
 		if err != nil {
 			fmt.Printf("bad credentials: %s", err)
@@ -110,29 +236,7 @@ and returns a user name and password you can use to login`,
 		cfg := aws.NewConfig().WithCredentials(creds)
 		svc := iam.New(session.New(), cfg)
 
-		// AWS is eventually consistent so the account might not be available
-		// immediately. So do this janky loop thing until it becomes available.
-		log.Info("Waiting for account to become available...")
-		for {
-			_, err = svc.ListUsers(nil)
-			if err != nil {
-				if awsErr, ok := err.(awserr.Error); ok {
-					if awsErr.Code() == "InvalidClientTokenId" {
-						// We'll see this error code until the account is available
-						log.Debug("Account is not available yet...")
-						time.Sleep(time.Second)
-						continue
-					} else {
-						// If the error code is anything else we have other problems
-						log.Fatal("AWS returned an unexpected error: ", err)
-					}
-				} else {
-					// And catch any non-AWS errors:
-					log.Fatal("Error: ", err.Error())
-				}
-			}
-			break
-		}
+		waitForIAMUser(svc)
 		log.Info("Account is available. Creating Login Profile...")
 
 		// GetAccessKeyLastUsed returns a struct with the Username that vault has generated
@@ -157,7 +261,11 @@ and returns a user name and password you can use to login`,
 		fmt.Println("UserName: ", *lastused.UserName)
 		fmt.Println("Password: ", password)
 
-		// Create the Login Profile
+		// Create the Login Profile, after making sure it can be deleted if we're killed
+		cleanup.LoginProfileUser = *lastused.UserName
+		cleanup.AccessKey = response.AccessKey
+		cleanup.SecretKey = response.SecretKey
+		cleanup.ID = saveCleanup(cleanup)
 		_, err = svc.CreateLoginProfile(&iam.CreateLoginProfileInput{
 			Password:              &password,
 			PasswordResetRequired: &required,
@@ -167,52 +275,184 @@ and returns a user name and password you can use to login`,
 			log.Fatal("Could not create Login Profile: ", err)
 		}
 
-		// Set up a trap for Ctrl-C so we can clean up the Login Profile
-		var wg sync.WaitGroup
-		wg.Add(1)
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-c
-			defer wg.Done()
-			// If Ctrl-C is hit really quickly the login profile might not be
-			// available yet. So do another janky loop thing.
-			for {
-				_, err = svc.DeleteLoginProfile(&iam.DeleteLoginProfileInput{
-					UserName: lastused.UserName,
-				})
-				if err != nil {
-					if awsErr, ok := err.(awserr.Error); ok {
-						if awsErr.Code() == "EntityTemporarilyUnmodifiable" {
-							// If the Login Profile is not ready we'll see this error code
-							log.Debug("Login Profile is not available yet...")
-							time.Sleep(time.Second)
-							continue
-						} else {
-							// If the error code is anything else we have other problems
-							log.Fatal("AWS returned an unexpected error: ", err)
-						}
-					} else {
-						// And catch any non-AWS errors:
-						log.Fatal("Problem removing Login Profile: ", err.Error())
-					}
+		// Wait for Ctrl-C, then delete the login profile, remove the profile
+		// we wrote and revoke the lease, the same way a task left behind by a
+		// killed session would be finished
+		waitForInterrupt()
+		endSession(client, cleanup)
+	},
+}
+
+// waitForIAMUser waits for the access key of a new IAM user to become
+// usable. AWS is eventually consistent so the account might not be
+// available immediately. So do this janky loop thing until it becomes
+// available. Being denied access means the key works, it's only the user's
+// policy that doesn't allow listing users
+func waitForIAMUser(svc *iam.IAM) {
+	log.Info("Waiting for account to become available...")
+	for {
+		_, err := svc.ListUsers(nil)
+		if err != nil {
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "InvalidClientTokenId" {
+					// We'll see this error code until the account is available
+					log.Debug("Account is not available yet...")
+					time.Sleep(time.Second)
+					continue
+				} else if awsErr.Code() != "AccessDenied" {
+					// If the error code is anything else we have other problems
+					log.Fatal("AWS returned an unexpected error: ", err)
 				}
-				break
+			} else {
+				// And catch any non-AWS errors:
+				log.Fatal("Error: ", err.Error())
 			}
-		}()
+		}
+		break
+	}
+}
+
+// checkAWSCredentialFlags makes sure the STS flags are only given with a
+// credential type that uses them, rather than quietly ignoring them
+func checkAWSCredentialFlags() error {
+	switch awsCredentialType {
+	case "iam_user":
+		if awsTTL != "" || awsRoleARN != "" || awsSessionName != "" {
+			return fmt.Errorf("--ttl, --role-arn and --session-name can only be used with STS credentials, see --credential-type")
+		}
+	case "assumed_role":
+	case "federation_token":
+		if awsRoleARN != "" || awsSessionName != "" {
+			return fmt.Errorf("--role-arn and --session-name can only be used with assumed_role credentials")
+		}
+	default:
+		return fmt.Errorf("unknown credential type: %s", awsCredentialType)
+	}
+
+	return nil
+}
+
+// readAWSCredentials reads a new set of AWS credentials for role from
+// vault, using the credential type asked for on the command line
+func readAWSCredentials(client *api.Client, role string) (*api.Secret, error) {
+	switch awsCredentialType {
+	case "iam_user":
+		return readSecret(client, role)
+	case "assumed_role", "federation_token":
+	default:
+		return nil, fmt.Errorf("unknown credential type: %s", awsCredentialType)
+	}
+
+	options := map[string]interface{}{}
+
+	if awsTTL != "" {
+		options["ttl"] = awsTTL
+	}
+
+	if awsRoleARN != "" {
+		options["role_arn"] = awsRoleARN
+	}
+
+	if awsSessionName != "" {
+		options["role_session_name"] = awsSessionName
+	}
+
+	path := awsSTSPath(role)
+
+	log.WithFields(log.Fields{"path": path,
+		"type": awsCredentialType}).Debug("requesting STS credentials")
+
+	return writeSecret(client, path, options)
+}
+
+// awsRoleCredentialTypes returns the types of credentials an aws role can
+// give out, from its config. It returns nil if we aren't allowed to read
+// the config, or the role is from a vault too old to say
+func awsRoleCredentialTypes(client *api.Client, role string) []string {
+	i := strings.LastIndex(role, "/creds/")
+
+	if i < 0 {
+		return nil
+	}
 
-		// Wait for Ctrl-C
-		fmt.Println("Press Ctrl-C when finished...")
-		runtime.Gosched()
-		wg.Wait()
+	path := role[:i] + "/roles/" + role[i+len("/creds/"):]
 
-		// Revoke Vault lease to remove AWS account
-		err = client.Sys().Revoke(secret.LeaseID)
+	config, err := client.Logical().Read(path)
+
+	if err != nil || config == nil {
+		log.Debug("Could not read aws role config from ", path, ": ", err)
+		return nil
+	}
+
+	if credentialType, ok := config.Data["credential_type"].(string); ok && credentialType != "" {
+		return []string{credentialType}
+	}
+
+	list, ok := config.Data["credential_types"].([]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	var types []string
+	for _, t := range list {
+		types = append(types, fmt.Sprint(t))
+	}
+
+	return types
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// awsSTSPath turns the path of an aws role, such as aws/creds/admin, into
+// the path to request STS credentials for it from, aws/sts/admin
+func awsSTSPath(role string) string {
+	if i := strings.LastIndex(role, "/creds/"); i >= 0 {
+		return role[:i] + "/sts/" + role[i+len("/creds/"):]
+	}
+
+	return role
+}
+
+// pickAWSRole asks the user which of the aws roles they can get
+// credentials for they want to use
+func pickAWSRole(client *api.Client) string {
+	mounts, err := mountsOfType(client, "aws")
+
+	if err != nil {
+		log.Fatal("Error listing AWS backends: ", err)
+	}
+
+	var candidates []string
+	for _, mount := range mounts {
+		roles, err := readableRoles(client, mount, "creds", "read")
+
+		// offer the roles from the backends we can see into
 		if err != nil {
-			log.Fatal("Problem revoking Vault lease: ", err)
+			log.Warn("Error listing roles for ", mount, ": ", err)
+			continue
 		}
-		log.Info("Vault Lease revoked. AWS account removed.")
-	},
+
+		for _, role := range roles {
+			candidates = append(candidates, mount+"/creds/"+role)
+		}
+	}
+
+	role, err := pick("aws", "Select an AWS role", candidates, false)
+
+	if err != nil {
+		log.Fatal("No AWS role selected: ", err)
+	}
+
+	return role
 }
 
 func init() {
@@ -226,6 +466,21 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	awsCmd.Flags().StringVarP(&awsRole, "role", "R", "", "Vault AWS Role to generate credentials for")
+	awsCmd.PersistentFlags().StringVarP(&awsRole, "role", "R", "", "Vault AWS Role to generate credentials for")
 	awsCmd.Flags().BoolVarP(&awsCreateLoginProfile, "create-login-profile", "L", false, "Create a Login Profile for the AWS account")
+	awsCmd.PersistentFlags().StringVarP(&awsCredentialType, "credential-type", "t", "iam_user", "Type of credentials to get: iam_user, assumed_role or federation_token")
+	awsCmd.PersistentFlags().StringVarP(&awsRoleARN, "role-arn", "", "", "ARN of the role to assume, if the Vault role allows more than one")
+	awsCmd.PersistentFlags().StringVarP(&awsTTL, "ttl", "", "", "How long STS credentials should be valid for")
+	awsCmd.PersistentFlags().StringVarP(&awsSessionName, "session-name", "", "", "Session name for assumed_role credentials")
+	awsCmd.PersistentFlags().String("region", "", "AWS region to set for commands run with the credentials")
+	viper.BindPFlag("region", awsCmd.PersistentFlags().Lookup("region"))
+	awsCmd.Flags().StringVarP(&awsWriteProfile, "write-profile", "", "", "Write the credentials to this profile in ~/.aws/credentials instead of printing them")
+	awsCmd.Flags().BoolVarP(&awsCleanup, "cleanup", "", false, "Wait for Ctrl-C, then remove the profile written by --write-profile and revoke the credentials")
+	awsCmd.Flags().BoolVarP(&awsConsole, "console", "", false, "Print a URL that signs in to the AWS console with STS credentials")
+	awsCmd.Flags().BoolVarP(&awsConsoleOpen, "open", "", false, "Open the console sign in URL in your browser")
+	awsCmd.Flags().DurationVarP(&awsConsoleDuration, "console-duration", "", 0, "How long the console session should last")
+	awsCmd.Flags().String("console-destination", "https://console.aws.amazon.com/", "Console page to send you to after signing in")
+	awsCmd.Flags().String("federation-url", defaultFederationURL, "AWS federation endpoint to get sign in tokens from")
+	viper.BindPFlag("console-destination", awsCmd.Flags().Lookup("console-destination"))
+	viper.BindPFlag("federation-url", awsCmd.Flags().Lookup("federation-url"))
 }
@@ -0,0 +1,115 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+const defaultFederationURL = "https://signin.aws.amazon.com/federation"
+
+var awsConsole bool
+var awsConsoleOpen bool
+var awsConsoleDuration time.Duration
+
+type federationSession struct {
+	SessionID    string `json:"sessionId"`
+	SessionKey   string `json:"sessionKey"`
+	SessionToken string `json:"sessionToken"`
+}
+
+type federationSigninToken struct {
+	SigninToken string `json:"SigninToken"`
+}
+
+// awsConsoleURL exchanges a set of STS credentials for a sign in token at
+// the AWS federation endpoint, and returns a URL that logs the user into
+// the console and sends them to destination. The session duration can only
+// be set for assumed_role credentials, federation tokens last as long as
+// the token does
+func awsConsoleURL(endpoint string, creds AWSCredentialResp, credentialType string, destination string, duration time.Duration) (string, error) {
+	if creds.SecurityToken == "" {
+		return "", fmt.Errorf("console sign in needs STS credentials, see --credential-type")
+	}
+
+	session, err := json.Marshal(federationSession{
+		SessionID:    creds.AccessKey,
+		SessionKey:   creds.SecretKey,
+		SessionToken: creds.SecurityToken,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(session))
+
+	if duration > 0 && credentialType == "assumed_role" {
+		query.Set("SessionDuration", fmt.Sprint(int(duration.Seconds())))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(endpoint + "?" + query.Encode())
+
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("federation endpoint returned %s", resp.Status)
+	}
+
+	var token federationSigninToken
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error parsing sign in token: %s", err)
+	}
+
+	login := url.Values{}
+	login.Set("Action", "login")
+	login.Set("Issuer", "breakglass")
+	login.Set("Destination", destination)
+	login.Set("SigninToken", token.SigninToken)
+
+	return endpoint + "?" + login.Encode(), nil
+}
+
+// openBrowser opens a URL in the user's default browser
+func openBrowser(target string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
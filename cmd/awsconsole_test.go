@@ -0,0 +1,126 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFederationServer returns a fake federation endpoint, which hands
+// out a sign in token and remembers the last request it got
+func newFederationServer(last *url.Values) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r.URL.Query()
+
+		if last.Get("Action") != "getSigninToken" {
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(federationSigninToken{SigninToken: "test-signin-token"})
+	}))
+}
+
+var testSTSCredentials = AWSCredentialResp{
+	AccessKey:     "ASIATEST",
+	SecretKey:     "secret",
+	SecurityToken: "token",
+}
+
+func TestAWSConsoleURL(t *testing.T) {
+	var last url.Values
+	server := newFederationServer(&last)
+	defer server.Close()
+
+	signinURL, err := awsConsoleURL(server.URL, testSTSCredentials, "assumed_role", "https://console.aws.amazon.com/", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var session federationSession
+	if err := json.Unmarshal([]byte(last.Get("Session")), &session); err != nil {
+		t.Fatal("session isn't valid JSON: ", err)
+	}
+
+	if session.SessionID != "ASIATEST" || session.SessionKey != "secret" || session.SessionToken != "token" {
+		t.Errorf("session = %+v, want the STS credentials", session)
+	}
+
+	if got := last.Get("SessionDuration"); got != "3600" {
+		t.Errorf("SessionDuration = %q, want 3600", got)
+	}
+
+	if !strings.HasPrefix(signinURL, server.URL+"?") {
+		t.Fatalf("sign in URL %s isn't on the federation endpoint", signinURL)
+	}
+
+	login, err := url.Parse(signinURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := login.Query()
+
+	if query.Get("Action") != "login" || query.Get("SigninToken") != "test-signin-token" || query.Get("Destination") != "https://console.aws.amazon.com/" {
+		t.Errorf("sign in URL has the wrong parameters: %s", signinURL)
+	}
+}
+
+func TestAWSConsoleURLFederationToken(t *testing.T) {
+	var last url.Values
+	server := newFederationServer(&last)
+	defer server.Close()
+
+	if _, err := awsConsoleURL(server.URL, testSTSCredentials, "federation_token", "https://console.aws.amazon.com/", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := last["SessionDuration"]; ok {
+		t.Error("SessionDuration was sent for federation_token credentials")
+	}
+}
+
+func TestAWSConsoleURLNeedsSTS(t *testing.T) {
+	creds := AWSCredentialResp{AccessKey: "AKIATEST", SecretKey: "secret"}
+
+	if _, err := awsConsoleURL("http://127.0.0.1:0", creds, "iam_user", "https://console.aws.amazon.com/", 0); err == nil {
+		t.Error("expected an error for credentials without a security token")
+	}
+}
+
+func TestAWSConsoleURLEndpointError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := awsConsoleURL(server.URL, testSTSCredentials, "assumed_role", "https://console.aws.amazon.com/", 0); err == nil {
+		t.Error("expected an error when the federation endpoint fails")
+	}
+}
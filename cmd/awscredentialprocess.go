@@ -0,0 +1,213 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// cached credentials are thrown away this long before they expire, so
+// the SDK never gets credentials that are about to stop working
+const awsCredentialRefreshMargin = 5 * time.Minute
+
+// AWSCredentialProcessResp is the document the AWS SDKs expect from a
+// credential_process
+type AWSCredentialProcessResp struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string `json:",omitempty"`
+	Expiration      string `json:",omitempty"`
+}
+
+// awsCredentialProcessCmd represents the aws credential-process command
+var awsCredentialProcessCmd = &cobra.Command{
+	Use:   "credential-process",
+	Short: "Print AWS credentials for use as a credential_process",
+	Long: `Prints AWS credentials in the format the AWS SDKs and CLI expect from a
+credential_process, so they can call breakglass whenever they need credentials.
+Add something like this to ~/.aws/config:
+
+  [profile breakglass]
+  credential_process = breakglass aws credential-process --role aws/creds/admin --credential-type assumed_role
+
+Only STS credentials can be used, so --credential-type has to be given.
+The vault token and the credentials are cached until shortly before they
+expire, so repeated calls don't create new vault leases.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if awsRole == "" {
+			log.Fatal("No AWS role specified. See --help")
+		}
+
+		if err := checkAWSCredentialFlags(); err != nil {
+			log.Fatal(err)
+		}
+
+		if viper.GetString("wrap-ttl") != "" {
+			log.Fatal("--wrap-ttl can't be used with credential-process")
+		}
+
+		// a new IAM user's key doesn't work straight away, and every lease
+		// would leave another IAM user behind until it expires
+		if awsCredentialType == "iam_user" {
+			log.Fatal("credential-process needs STS credentials, use --credential-type assumed_role or federation_token")
+		}
+
+		cacheFile, err := awsCredentialCacheFile()
+
+		if err != nil {
+			log.Fatal("Could not find credential cache: ", err)
+		}
+
+		// reuse cached credentials if they're still good for a while
+		if creds, ok := readCachedAWSCredentials(cacheFile); ok {
+			printCredentialProcess(creds)
+			return
+		}
+
+		client := getCachedVaultClient()
+
+		secret, err := readAWSCredentials(client, awsRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check the role exists in vault: ", awsRole)
+		}
+
+		var response AWSCredentialResp
+
+		if err := mapstructure.Decode(secret.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		creds := AWSCredentialProcessResp{
+			Version:         1,
+			AccessKeyId:     response.AccessKey,
+			SecretAccessKey: response.SecretKey,
+			SessionToken:    response.SecurityToken,
+		}
+
+		if secret.LeaseDuration > 0 {
+			expires := time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+			creds.Expiration = expires.UTC().Format(time.RFC3339)
+
+			if err := writeCachedAWSCredentials(cacheFile, creds); err != nil {
+				log.Debug("Not caching credentials: ", err)
+			}
+		}
+
+		printCredentialProcess(creds)
+	},
+}
+
+// awsCredentialCacheFile returns where credentials for the role and
+// credential type we were asked for are cached
+func awsCredentialCacheFile() (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.Join([]string{viper.GetString("vault"), awsRole, awsCredentialType, awsRoleARN}, "_")
+	name = strings.NewReplacer("/", "_", ":", "_").Replace(name)
+
+	return filepath.Join(homeDir, ".breakglass", "cache", "aws-"+name+".json"), nil
+}
+
+// readCachedAWSCredentials returns the cached credentials, if there are
+// any that aren't about to expire
+func readCachedAWSCredentials(path string) (AWSCredentialProcessResp, bool) {
+	var creds AWSCredentialProcessResp
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return creds, false
+	}
+
+	if err := json.Unmarshal(data, &creds); err != nil {
+		log.Debug("Ignoring unreadable credential cache: ", err)
+		return creds, false
+	}
+
+	expires, err := time.Parse(time.RFC3339, creds.Expiration)
+
+	if err != nil || time.Until(expires) < awsCredentialRefreshMargin {
+		log.Debug("Cached credentials have expired")
+		return creds, false
+	}
+
+	log.Debug("Using cached credentials from ", path)
+
+	return creds, true
+}
+
+// writeCachedAWSCredentials saves credentials for the next call
+func writeCachedAWSCredentials(path string, creds AWSCredentialProcessResp) error {
+	data, err := json.Marshal(creds)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func printCredentialProcess(creds AWSCredentialProcessResp) {
+	data, err := json.Marshal(creds)
+
+	if err != nil {
+		log.Fatal("Error encoding credentials: ", err)
+	}
+
+	fmt.Println(string(data))
+}
+
+func init() {
+	awsCmd.AddCommand(awsCredentialProcessCmd)
+}
@@ -0,0 +1,196 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+var awsWriteProfile string
+var awsCleanup bool
+
+// awsCredentialsFile returns the path of the shared AWS credentials file
+func awsCredentialsFile() (string, error) {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".aws", "credentials"), nil
+}
+
+// writeAWSProfile adds or replaces a profile in the shared credentials file,
+// leaving every other profile alone. The expiry and vault lease are
+// recorded in the profile so it's clear where the credentials came from
+func writeAWSProfile(path string, name string, creds AWSCredentialResp, expires time.Time, leaseID string) error {
+	lines := []string{
+		"[" + name + "]",
+		"aws_access_key_id = " + creds.AccessKey,
+		"aws_secret_access_key = " + creds.SecretKey,
+	}
+
+	if creds.SecurityToken != "" {
+		lines = append(lines, "aws_session_token = "+creds.SecurityToken)
+	}
+
+	if !expires.IsZero() {
+		lines = append(lines, "breakglass_expiration = "+expires.UTC().Format(time.RFC3339))
+	}
+
+	if leaseID != "" {
+		lines = append(lines, "breakglass_lease_id = "+leaseID)
+	}
+
+	return updateINIFile(path, name, lines)
+}
+
+// removeAWSProfile removes a profile from the shared credentials file
+func removeAWSProfile(path string, name string) error {
+	return updateINIFile(path, name, nil)
+}
+
+// updateINIFile replaces a section of an ini file with lines, or removes it
+// if lines is empty. The file is replaced atomically so a failed write can't
+// lose the other sections
+func updateINIFile(path string, section string, lines []string) error {
+	// update the file a symlink points to, rather than replacing the link
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	updated := replaceINISection(string(content), section, lines)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".breakglass")
+
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(updated); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// replaceINISection returns content with section replaced by lines. Comments
+// and blank lines directly above the next section header are kept, as they
+// usually belong to that section
+func replaceINISection(content string, section string, lines []string) string {
+	existing := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		existing = nil
+	}
+
+	header := "[" + section + "]"
+
+	var out []string
+	found := false
+
+	for i := 0; i < len(existing); i++ {
+		if strings.TrimSpace(existing[i]) != header {
+			out = append(out, existing[i])
+			continue
+		}
+
+		// find the start of the next section
+		end := i + 1
+		for end < len(existing) && !strings.HasPrefix(strings.TrimSpace(existing[end]), "[") {
+			end++
+		}
+
+		// keep the comments that lead into the next section
+		keep := end
+		for keep > i+1 && isINIComment(existing[keep-1]) {
+			keep--
+		}
+
+		if !found {
+			out = append(out, lines...)
+			found = true
+		}
+
+		// don't leave a double gap where a section was removed, or a gap at
+		// the top of the file
+		kept := existing[keep:end]
+		for len(kept) > 0 && strings.TrimSpace(kept[0]) == "" && (len(out) == 0 || strings.TrimSpace(out[len(out)-1]) == "") {
+			kept = kept[1:]
+		}
+		out = append(out, kept...)
+
+		i = end - 1
+	}
+
+	if !found && len(lines) > 0 {
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+	}
+
+	// a removed last section would leave a gap at the bottom too
+	for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return ""
+	}
+
+	return strings.Join(out, "\n") + "\n"
+}
+
+func isINIComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
@@ -0,0 +1,156 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceINISection(t *testing.T) {
+	lines := []string{"[breakglass]", "aws_access_key_id = new"}
+
+	tests := []struct {
+		name    string
+		content string
+		lines   []string
+		want    string
+	}{
+		{
+			"add to an empty file",
+			"",
+			lines,
+			"[breakglass]\naws_access_key_id = new\n",
+		},
+		{
+			"add after the other sections",
+			"[default]\naws_access_key_id = mine\n",
+			lines,
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = new\n",
+		},
+		{
+			"replace",
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = old\n\n[prod]\naws_access_key_id = prod\n",
+			lines,
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = new\n\n[prod]\naws_access_key_id = prod\n",
+		},
+		{
+			"remove",
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = old\n\n[prod]\naws_access_key_id = prod\n",
+			nil,
+			"[default]\naws_access_key_id = mine\n\n[prod]\naws_access_key_id = prod\n",
+		},
+		{
+			"replace the first section",
+			"[breakglass]\naws_access_key_id = old\n\n[default]\naws_access_key_id = mine\n",
+			lines,
+			"[breakglass]\naws_access_key_id = new\n\n[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"remove the first section",
+			"[breakglass]\naws_access_key_id = old\n\n[default]\naws_access_key_id = mine\n",
+			nil,
+			"[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"replace the last section",
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = old\n",
+			lines,
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = new\n",
+		},
+		{
+			"remove the last section",
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = old\n",
+			nil,
+			"[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"remove the only section",
+			"[breakglass]\naws_access_key_id = old\n",
+			nil,
+			"",
+		},
+		{
+			"keep the comments before the next header",
+			"[breakglass]\naws_access_key_id = old\n\n# production, don't touch\n[prod]\naws_access_key_id = prod\n",
+			lines,
+			"[breakglass]\naws_access_key_id = new\n\n# production, don't touch\n[prod]\naws_access_key_id = prod\n",
+		},
+		{
+			"keep the comments before the next header when removing",
+			"[default]\naws_access_key_id = mine\n\n[breakglass]\naws_access_key_id = old\n; production\n[prod]\naws_access_key_id = prod\n",
+			nil,
+			"[default]\naws_access_key_id = mine\n\n; production\n[prod]\naws_access_key_id = prod\n",
+		},
+		{
+			"remove a section that isn't there",
+			"[default]\naws_access_key_id = mine\n",
+			nil,
+			"[default]\naws_access_key_id = mine\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := replaceINISection(test.content, "breakglass", test.lines); got != test.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUpdateINIFileSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breakglass")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "credentials")
+	link := filepath.Join(dir, "link")
+
+	if err := ioutil.WriteFile(target, []byte("[default]\naws_access_key_id = mine\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("can't create symlinks: ", err)
+	}
+
+	if err := updateINIFile(link, "breakglass", []string{"[breakglass]"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s is no longer a symlink", link)
+	}
+
+	content, err := ioutil.ReadFile(target)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "[default]\naws_access_key_id = mine\n\n[breakglass]\n"; string(content) != want {
+		t.Errorf("credentials file = %q, want %q", content, want)
+	}
+}
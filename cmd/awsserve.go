@@ -0,0 +1,238 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var awsServeListen string
+var awsServeToken string
+
+// AWSContainerCredentialResp is the document served by the ECS container
+// credentials endpoint
+type AWSContainerCredentialResp struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string `json:",omitempty"`
+}
+
+// awsCredentialServer hands out credentials from vault, getting new ones
+// when the current ones are about to expire
+type awsCredentialServer struct {
+	client *api.Client
+	token  string
+
+	mu      sync.Mutex
+	creds   AWSContainerCredentialResp
+	expires time.Time
+	leases  map[string]string // lease ID to cleanup task ID
+}
+
+// awsServeCmd represents the aws serve command
+var awsServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve AWS credentials like the ECS container credentials endpoint",
+	Long: `Runs a local server that hands out AWS credentials in the same way as the
+ECS container credentials endpoint, for tools which only pick up credentials
+from there. Credentials are refreshed from vault before they expire, and
+every lease is revoked when the server is stopped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if awsRole == "" {
+			log.Fatal("No AWS role specified. See --help")
+		}
+
+		if err := checkAWSCredentialFlags(); err != nil {
+			log.Fatal(err)
+		}
+
+		if viper.GetString("wrap-ttl") != "" {
+			log.Fatal("Credentials can't be served with --wrap-ttl")
+		}
+
+		if awsServeToken == "" {
+			awsServeToken = randomToken()
+		}
+
+		server := &awsCredentialServer{
+			client: getVaultClient(),
+			token:  awsServeToken,
+			leases: map[string]string{},
+		}
+
+		// get the first set of credentials now, so problems show up straight away
+		if _, err := server.credentials(); err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		// the server runs for longer than a vault login lasts
+		stop := make(chan struct{})
+		go keepTokenRenewed(server.client, stop)
+
+		httpServer := &http.Server{Addr: awsServeListen, Handler: server}
+
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				server.revokeAll()
+				log.Fatal("Error running credential server: ", err)
+			}
+		}()
+
+		fmt.Println("Serving AWS credentials. Use them with:")
+		fmt.Printf("export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/\n", awsServeListen)
+		fmt.Printf("export AWS_CONTAINER_AUTHORIZATION_TOKEN=%s\n", awsServeToken)
+
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		fmt.Println("Press Ctrl-C to stop...")
+		<-c
+
+		close(stop)
+		httpServer.Close()
+		server.revokeAll()
+	},
+}
+
+func (s *awsCredentialServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.token)) != 1 {
+		log.Warn("Rejected credential request from ", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.credentials()
+
+	if err != nil {
+		log.Error("Error getting credentials: ", err)
+		http.Error(w, "error getting credentials", http.StatusInternalServerError)
+		return
+	}
+
+	log.Debug("Served credentials to ", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creds)
+}
+
+// credentials returns the current credentials, reading new ones from vault
+// if they're about to expire
+func (s *awsCredentialServer) credentials() (AWSContainerCredentialResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds.AccessKeyId != "" && (s.expires.IsZero() || time.Until(s.expires) > awsCredentialRefreshMargin) {
+		return s.creds, nil
+	}
+
+	log.Info("Getting new credentials from vault")
+
+	secret, err := readAWSCredentials(s.client, awsRole)
+
+	if err != nil {
+		return s.creds, err
+	}
+
+	if secret == nil {
+		return s.creds, fmt.Errorf("no credentials were retrieved for %s", awsRole)
+	}
+
+	if secret.LeaseID != "" {
+		s.leases[secret.LeaseID] = saveCleanup(cleanupTask{LeaseID: secret.LeaseID})
+	}
+
+	var response AWSCredentialResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		return s.creds, err
+	}
+
+	s.creds = AWSContainerCredentialResp{
+		AccessKeyId:     response.AccessKey,
+		SecretAccessKey: response.SecretKey,
+		Token:           response.SecurityToken,
+	}
+	s.expires = time.Time{}
+
+	if secret.LeaseDuration > 0 {
+		s.expires = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+		s.creds.Expiration = s.expires.UTC().Format(time.RFC3339)
+	}
+
+	return s.creds, nil
+}
+
+// revokeAll revokes every lease we got while serving
+func (s *awsCredentialServer) revokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for lease, cleanupID := range s.leases {
+		if err := s.client.Sys().Revoke(lease); err != nil {
+			log.Error("Problem revoking Vault lease ", lease, ": ", err)
+			continue
+		}
+		log.Info("Vault Lease revoked: ", lease)
+		finishCleanup(cleanupID)
+		delete(s.leases, lease)
+	}
+}
+
+// randomToken returns a random string to protect local endpoints with
+func randomToken() string {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal("Error generating token: ", err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func init() {
+	awsCmd.AddCommand(awsServeCmd)
+
+	awsServeCmd.Flags().StringVarP(&awsServeListen, "listen", "", "127.0.0.1:9911", "Address to serve credentials on")
+	awsServeCmd.Flags().StringVarP(&awsServeToken, "auth-token", "", "", "Token clients must send in the Authorization header (default is a random token)")
+}
@@ -0,0 +1,146 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var azureMount string
+var azureRole string
+var azureExport bool
+
+type AzureCredentialResp struct {
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+}
+
+// azureCmd represents the azure command
+var azureCmd = &cobra.Command{
+	Use:   "azure [-- command args...]",
+	Short: "Get temporary credentials for Azure subscriptions",
+	Long: `Gets a temporary service principal for an Azure role from vault.
+
+With --exec, or a command after --, the command is run with the credentials
+in the ARM_* and AZURE_* environment variables, and the service principal is
+revoked when it exits.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if azureRole == "" {
+			log.Fatal("No Azure role specified. See --help")
+		}
+
+		tenant := viper.GetString("azure-tenant")
+		subscription := viper.GetString("azure-subscription")
+
+		// get vault client
+		client := getVaultClient()
+
+		secret, err := readSecret(client, azureMount+"/creds/"+azureRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", azureRole)
+		}
+
+		recordHistory("azure", azureRole)
+
+		if wrapped(secret) {
+			return
+		}
+
+		var response AzureCredentialResp
+
+		if err := mapstructure.Decode(secret.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		env := []string{
+			"ARM_CLIENT_ID=" + response.ClientID,
+			"ARM_CLIENT_SECRET=" + response.ClientSecret,
+			"AZURE_CLIENT_ID=" + response.ClientID,
+			"AZURE_CLIENT_SECRET=" + response.ClientSecret,
+		}
+
+		if tenant != "" {
+			env = append(env, "ARM_TENANT_ID="+tenant, "AZURE_TENANT_ID="+tenant)
+		}
+
+		if subscription != "" {
+			env = append(env, "ARM_SUBSCRIPTION_ID="+subscription, "AZURE_SUBSCRIPTION_ID="+subscription)
+		}
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running command with Azure credentials")
+
+			session := startSession(cleanupTask{LeaseID: secret.LeaseID})
+
+			execSession(client, args, env, session)
+		}
+
+		if azureExport {
+			for _, e := range env {
+				parts := strings.SplitN(e, "=", 2)
+				fmt.Println("export " + parts[0] + "=" + shellQuote(parts[1]))
+			}
+			return
+		}
+
+		fmt.Println("Your Azure Credentials are below:")
+		fmt.Println("client_id: ", response.ClientID)
+		fmt.Println("client_secret: ", response.ClientSecret)
+		fmt.Println("tenant_id: ", tenant)
+		fmt.Println("subscription_id: ", subscription)
+	},
+}
+
+// shellQuote quotes a value so the shell takes it literally
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func init() {
+	RootCmd.AddCommand(azureCmd)
+
+	azureCmd.Flags().StringVarP(&azureRole, "role", "r", "", "Azure role to get credentials for")
+	azureCmd.Flags().StringVarP(&azureMount, "mount", "", "azure", "Path the Azure secrets engine is mounted at")
+	azureCmd.Flags().BoolVarP(&azureExport, "export", "", false, "Print the credentials as shell export statements")
+	azureCmd.Flags().String("tenant", "", "Azure tenant ID")
+	azureCmd.Flags().String("subscription", "", "Azure subscription ID")
+	viper.BindPFlag("azure-tenant", azureCmd.Flags().Lookup("tenant"))
+	viper.BindPFlag("azure-subscription", azureCmd.Flags().Lookup("subscription"))
+}
@@ -0,0 +1,296 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bgentry/speakeasy"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var certRole string
+var certCommonName string
+var certMount string
+var certAltNames []string
+var certIPSANs []string
+var certTTL string
+var certKeyType string
+var certKeyBits int
+var certCSR bool
+var certFormat string
+var certOut string
+var certName string
+var certForce bool
+
+// certCmd represents the cert command
+var certCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Issue and manage certificates from a vault PKI backend",
+	Long: `Issues certificates from any vault PKI backend, and keeps track of the
+ones it issued in ~/.breakglass/certs.json so they can be listed and revoked`,
+}
+
+var certIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Issue a certificate",
+	Long: `Issues a certificate and writes it to --out. With --format pem the cert, key
+and CA chain are written as <name>.pem, <name>-key.pem and <name>-ca.pem.
+With --format bundle they are combined into <name>-bundle.pem, and with
+--format p12 into a PKCS#12 bundle <name>.p12, which needs openssl.
+
+With --csr the private key is generated locally and only a CSR is sent to
+vault, so the key never leaves this machine.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if certRole == "" || certCommonName == "" {
+			log.Fatal("No role or common name specified. See --help")
+		}
+
+		name := certName
+		if name == "" {
+			name = certCommonName
+		}
+
+		// the files are recorded, so they need to be found from anywhere
+		out, err := filepath.Abs(certOut)
+
+		if err != nil {
+			log.Fatal("Error finding output directory: ", err)
+		}
+
+		var files map[string]string
+		switch certFormat {
+		case "pem":
+			files = map[string]string{
+				"cert": filepath.Join(out, name+".pem"),
+				"key":  filepath.Join(out, name+"-key.pem"),
+				"ca":   filepath.Join(out, name+"-ca.pem"),
+			}
+		case "bundle":
+			files = map[string]string{"bundle": filepath.Join(out, name+"-bundle.pem")}
+		case "p12":
+			files = map[string]string{"p12": filepath.Join(out, name+".p12")}
+		default:
+			log.Fatal("Unknown format: ", certFormat, ". Use pem, bundle or p12")
+		}
+
+		if err := checkCertFiles(files, certForce); err != nil {
+			log.Fatal("Error writing cert: ", err)
+		}
+
+		// ask for the password before getting the cert, so we don't issue
+		// one nobody can use
+		var p12Password string
+		if certFormat == "p12" {
+			p12Password = getP12Password()
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		req := issuedCert{
+			Mount:      certMount,
+			Role:       certRole,
+			CommonName: certCommonName,
+			AltNames:   certAltNames,
+			IPSANs:     certIPSANs,
+			TTL:        certTTL,
+			KeyType:    certKeyType,
+			KeyBits:    certKeyBits,
+			CSR:        certCSR,
+			Files:      files,
+		}
+
+		secret, creds, err := issueCert(client, req)
+
+		if err != nil {
+			log.Fatal("Error issuing cert: ", err)
+		}
+
+		if wrapped(secret) {
+			return
+		}
+
+		if err := os.MkdirAll(out, 0700); err != nil {
+			log.Fatal("Error creating directory "+out+": ", err)
+		}
+
+		if err := writeCertFiles(files, creds, p12Password, certForce); err != nil {
+			log.Fatal("Error writing cert: ", err)
+		}
+
+		req.Serial = creds.SerialNumber
+		req.Issued = time.Now()
+		req.Expires, err = certExpiry(creds.Cert)
+
+		if err != nil {
+			log.Warn("Could not read cert expiry: ", err)
+		}
+
+		recordIssuedCert(req)
+
+		fmt.Printf("Issued cert for %s\n serial:  %s\n expires: %s\n", certCommonName, req.Serial, req.Expires.Local().Format(time.RFC1123))
+		for _, kind := range []string{"cert", "key", "ca", "bundle", "p12"} {
+			if path, ok := files[kind]; ok {
+				fmt.Printf(" %-7s  %s\n", kind+":", path)
+			}
+		}
+	},
+}
+
+var certRevokeCmd = &cobra.Command{
+	Use:   "revoke <serial>",
+	Short: "Revoke a certificate by serial number",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No serial number specified. See --help")
+		}
+
+		serial := args[0]
+
+		certs, err := loadIssuedCerts()
+
+		if err != nil {
+			log.Fatal("Error loading issued certs: ", err)
+		}
+
+		// use the mount the cert was issued from, unless told otherwise
+		mount := certMount
+		var remaining []issuedCert
+		for _, c := range certs {
+			if c.Serial != serial {
+				remaining = append(remaining, c)
+				continue
+			}
+			if !cmd.Flags().Changed("mount") {
+				mount = c.Mount
+			}
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		_, err = writeSecret(client, mount+"/revoke", map[string]interface{}{
+			"serial_number": serial,
+		})
+
+		if err != nil {
+			log.Fatal("Error revoking cert: ", err)
+		}
+
+		if len(remaining) != len(certs) {
+			if err := saveIssuedCerts(remaining); err != nil {
+				log.Warn("Could not update issued certs: ", err)
+			}
+		}
+
+		log.Info("Revoked cert " + serial)
+	},
+}
+
+var certListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the certificates issued from this machine",
+	Run: func(cmd *cobra.Command, args []string) {
+		certs, err := loadIssuedCerts()
+
+		if err != nil {
+			log.Fatal("Error loading issued certs: ", err)
+		}
+
+		if len(certs) == 0 {
+			log.Info("No certs have been issued")
+			return
+		}
+
+		for _, c := range certs {
+			status := "expires " + c.Expires.Local().Format(time.RFC1123)
+			if time.Now().After(c.Expires) {
+				status = "EXPIRED " + c.Expires.Local().Format(time.RFC1123)
+			}
+
+			fmt.Printf("%s  %s (%s/%s)  %s\n", c.Serial, c.CommonName, c.Mount, c.Role, status)
+			for _, path := range c.Files {
+				fmt.Printf("    %s\n", path)
+			}
+		}
+	},
+}
+
+// getP12Password returns the password to protect a PKCS#12 bundle with,
+// from BREAKGLASS_P12_PASSWORD or by asking for it
+func getP12Password() string {
+	if password := os.Getenv("BREAKGLASS_P12_PASSWORD"); password != "" {
+		return password
+	}
+
+	password, err := speakeasy.FAsk(os.Stderr, "Password for the PKCS#12 bundle: ")
+
+	if err != nil {
+		log.Fatal("Error reading password: ", err)
+	}
+
+	return password
+}
+
+func init() {
+	RootCmd.AddCommand(certCmd)
+	certCmd.AddCommand(certIssueCmd)
+	certCmd.AddCommand(certRevokeCmd)
+	certCmd.AddCommand(certListCmd)
+
+	certCmd.PersistentFlags().StringVarP(&certMount, "mount", "", "pki", "Path the PKI backend is mounted at")
+
+	certIssueCmd.Flags().StringVarP(&certRole, "role", "R", "", "PKI role to issue the cert with")
+	certIssueCmd.Flags().StringVarP(&certCommonName, "cn", "", "", "Common name for the cert")
+	certIssueCmd.Flags().StringSliceVarP(&certAltNames, "alt-names", "", nil, "Subject alternative names for the cert")
+	certIssueCmd.Flags().StringSliceVarP(&certIPSANs, "ip-sans", "", nil, "IP subject alternative names for the cert")
+	certIssueCmd.Flags().StringVarP(&certTTL, "ttl", "", "", "How long the cert should be valid for")
+	certIssueCmd.Flags().StringVarP(&certKeyType, "key-type", "", "", "Key type, rsa or ec (default is the role's)")
+	certIssueCmd.Flags().IntVarP(&certKeyBits, "key-bits", "", 0, "Key size. For ec keys this picks the curve: 256, 384 or 521")
+	certIssueCmd.Flags().BoolVarP(&certCSR, "csr", "", false, "Generate the key locally and have vault sign a CSR")
+	certIssueCmd.Flags().StringVarP(&certFormat, "format", "", "pem", "Output format: pem, bundle or p12")
+	certIssueCmd.Flags().StringVarP(&certOut, "out", "o", ".", "Directory to write the cert to")
+	certIssueCmd.Flags().StringVarP(&certName, "name", "", "", "Base name for the files (default is the common name)")
+	certIssueCmd.Flags().BoolVarP(&certForce, "force", "f", false, "Replace existing files")
+}
@@ -0,0 +1,237 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var certRenewAt float64
+var certReload string
+var certCheckInterval time.Duration
+var certRevokeOld bool
+
+// certWatchCmd represents the cert watch command
+var certWatchCmd = &cobra.Command{
+	Use:   "watch [common name...]",
+	Short: "Renew issued certificates before they expire",
+	Long: `Keeps the certs breakglass issued fresh. Each cert is issued again once
+--renew-at of its lifetime has passed, and its files are replaced atomically,
+so nothing ever sees a half written cert. --reload runs a shell command after
+each renewal, to tell whatever uses the cert to pick up the new one.
+
+Without any common names every recorded cert is watched. Certs issued while
+watch is running are picked up too.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if certRenewAt <= 0 || certRenewAt >= 1 {
+			log.Fatal("--renew-at must be between 0 and 1")
+		}
+
+		if viper.GetString("wrap-ttl") != "" {
+			log.Fatal("Certs can't be renewed with --wrap-ttl")
+		}
+
+		certs, err := loadIssuedCerts()
+
+		if err != nil {
+			log.Fatal("Error loading issued certs: ", err)
+		}
+
+		// ask for everything up front, as nobody will be around to answer later
+		var p12Password string
+		for _, c := range certs {
+			if _, ok := c.Files["p12"]; ok && watchingCert(c, args) {
+				p12Password = getP12Password()
+				break
+			}
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(c)
+
+		ticker := time.NewTicker(certCheckInterval)
+		defer ticker.Stop()
+
+		fmt.Println("Watching certs. Press Ctrl-C to stop...")
+
+		for {
+			renewCerts(client, args, p12Password)
+
+			select {
+			case <-c:
+				return
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// watchingCert returns true if cert is one of the common names we were
+// asked to watch, or if we're watching all of them
+func watchingCert(cert issuedCert, commonNames []string) bool {
+	if len(commonNames) == 0 {
+		return true
+	}
+
+	for _, name := range commonNames {
+		if cert.CommonName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renewDue returns true once the given fraction of a cert's lifetime has
+// passed
+func renewDue(cert issuedCert, fraction float64) bool {
+	lifetime := cert.Expires.Sub(cert.Issued)
+	return time.Now().After(cert.Issued.Add(time.Duration(float64(lifetime) * fraction)))
+}
+
+// renewCerts issues new certs for the watched ones that are due. Failures
+// are logged and tried again next time round, as the old cert may well
+// still be good for a while
+func renewCerts(client *api.Client, commonNames []string, p12Password string) {
+	// the vault token has to outlive the certs, so keep it going too
+	if _, err := client.Auth().Token().RenewSelf(0); err != nil {
+		log.Debug("Could not renew vault token: ", err)
+	}
+
+	certs, err := loadIssuedCerts()
+
+	if err != nil {
+		log.Error("Error loading issued certs: ", err)
+		return
+	}
+
+	for _, cert := range certs {
+		if !watchingCert(cert, commonNames) {
+			continue
+		}
+
+		if cert.Expires.IsZero() {
+			log.Debug("Not renewing ", cert.CommonName, ", its expiry is unknown")
+			continue
+		}
+
+		if !renewDue(cert, certRenewAt) {
+			continue
+		}
+
+		if err := renewCert(client, cert, p12Password); err != nil {
+			log.Error("Error renewing cert for ", cert.CommonName, ": ", err)
+		}
+	}
+}
+
+// renewCert issues cert again and swaps the new one in for the old one
+func renewCert(client *api.Client, cert issuedCert, p12Password string) error {
+	log.Info("Renewing cert for ", cert.CommonName, " (expires ", cert.Expires.Local().Format(time.RFC1123), ")")
+
+	_, creds, err := issueCert(client, cert)
+
+	if err != nil {
+		return err
+	}
+
+	if err := replaceCertFiles(cert.Files, creds, p12Password); err != nil {
+		return err
+	}
+
+	renewed := cert
+	renewed.Serial = creds.SerialNumber
+	renewed.Issued = time.Now()
+	renewed.Expires, err = certExpiry(creds.Cert)
+
+	if err != nil {
+		return err
+	}
+
+	recordIssuedCert(renewed)
+
+	log.Info("Renewed cert for ", cert.CommonName, ", new serial ", renewed.Serial)
+
+	if certRevokeOld {
+		_, err := writeSecret(client, cert.Mount+"/revoke", map[string]interface{}{
+			"serial_number": cert.Serial,
+		})
+
+		if err != nil {
+			log.Warn("Error revoking old cert ", cert.Serial, ": ", err)
+		}
+	}
+
+	if certReload != "" {
+		if err := runReload(certReload, renewed); err != nil {
+			log.Error("Reload command failed: ", err)
+		}
+	}
+
+	return nil
+}
+
+// runReload runs the reload command with the shell, telling it which cert
+// was renewed through the environment
+func runReload(command string, cert issuedCert) error {
+	reload := exec.Command("/bin/sh", "-c", command)
+	reload.Env = append(os.Environ(),
+		"BREAKGLASS_CERT_CN="+cert.CommonName,
+		"BREAKGLASS_CERT_SERIAL="+cert.Serial)
+	reload.Stdout = os.Stdout
+	reload.Stderr = os.Stderr
+
+	log.Debug("Running reload command ", command)
+
+	return reload.Run()
+}
+
+func init() {
+	certCmd.AddCommand(certWatchCmd)
+
+	certWatchCmd.Flags().Float64VarP(&certRenewAt, "renew-at", "", 0.66, "Fraction of a cert's lifetime after which it's renewed")
+	certWatchCmd.Flags().StringVarP(&certReload, "reload", "", "", "Shell command to run after a cert is renewed")
+	certWatchCmd.Flags().DurationVarP(&certCheckInterval, "interval", "", time.Minute, "How often to check for certs that need renewing")
+	certWatchCmd.Flags().BoolVarP(&certRevokeOld, "revoke-old", "", false, "Revoke the old cert once it's been replaced")
+}
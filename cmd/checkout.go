@@ -0,0 +1,189 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var checkoutTTL string
+
+type LibraryCheckoutResp struct {
+	ServiceAccountName string `mapstructure:"service_account_name"`
+	Password           string `mapstructure:"password"`
+}
+
+// checkoutCmd represents the checkout command
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout <set>",
+	Short: "Check out a shared service account from an LDAP library set",
+	Long: `Checks out one of the accounts in an LDAP (or AD) secrets engine library
+set and shows its password. The check-out is renewed until you hit Ctrl-C,
+when the account is checked back in, so vault rotates its password.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No library set specified. See --help")
+		}
+
+		set := args[0]
+		mount := viper.GetString("library-mount")
+
+		// get vault client
+		client := getVaultClient()
+
+		secret, account := checkoutAccount(client, mount, set)
+
+		if secret == nil {
+			return
+		}
+
+		session := startSession(cleanupTask{LibraryMount: mount, LibrarySet: set, ServiceAccount: account.ServiceAccountName})
+
+		fmt.Printf("Your %s Credentials are below\n username: %s\n password: %s\n", set, account.ServiceAccountName, account.Password)
+
+		stop := make(chan struct{})
+		go keepLeaseRenewed(client, secret, stop)
+
+		waitForInterrupt()
+		close(stop)
+
+		endSession(client, session)
+	},
+}
+
+// checkinCmd represents the checkin command
+var checkinCmd = &cobra.Command{
+	Use:   "checkin <set> [account...]",
+	Short: "Check accounts back in to an LDAP library set",
+	Long: `Checks in accounts checked out with breakglass checkout, for when the
+session that checked them out can't do it itself. Without any accounts,
+the ones breakglass checked out of the set are checked in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) < 1 {
+			log.Fatal("No library set specified. See --help")
+		}
+
+		set := args[0]
+		mount := viper.GetString("library-mount")
+
+		// get vault client
+		client := getVaultClient()
+
+		if len(args) > 1 {
+			for _, account := range args[1:] {
+				if err := checkInAccount(client, mount, set, account); err != nil {
+					log.Fatal("Error checking in ", account, ": ", err)
+				}
+				log.Info("Checked in ", account)
+			}
+			return
+		}
+
+		var found bool
+		for _, task := range loadCleanupTasks() {
+			if task.Vault != viper.GetString("vault") || task.LibraryMount != mount || task.LibrarySet != set {
+				continue
+			}
+
+			found = true
+			endSession(client, task)
+		}
+
+		if !found {
+			log.Fatal("No accounts from ", set, " are checked out by breakglass. Name the accounts to check in")
+		}
+	},
+}
+
+// checkoutAccount checks out an account from a library set. It returns a
+// nil secret if the response was wrapped for someone else
+func checkoutAccount(client *api.Client, mount string, set string) (*api.Secret, *LibraryCheckoutResp) {
+	options := map[string]interface{}{}
+
+	if checkoutTTL != "" {
+		options["ttl"] = checkoutTTL
+	}
+
+	secret, err := writeSecret(client, mount+"/library/"+set+"/check-out", options)
+
+	if err != nil {
+		log.Fatal("Error checking out account: ", err)
+	}
+
+	if secret == nil {
+		log.Fatal("No account was checked out. Check the library set exists in vault: ", set)
+	}
+
+	if wrapped(secret) {
+		return nil, nil
+	}
+
+	var response LibraryCheckoutResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		log.Fatal("Error parsing vault's credential response: ", err)
+	}
+
+	return secret, &response
+}
+
+// checkInAccount checks an account back in to a library set, which has
+// vault rotate its password
+func checkInAccount(client *api.Client, mount string, set string, account string) error {
+	_, err := client.Logical().Write(mount+"/library/"+set+"/check-in", map[string]interface{}{
+		"service_account_names": []string{account},
+	})
+
+	return err
+}
+
+func init() {
+	RootCmd.AddCommand(checkoutCmd)
+	RootCmd.AddCommand(checkinCmd)
+
+	checkoutCmd.Flags().StringVarP(&checkoutTTL, "ttl", "", "", "How long to check the account out for (default is the set's)")
+	checkoutCmd.Flags().String("mount", "ldap", "Path the LDAP secrets engine is mounted at")
+	checkinCmd.Flags().AddFlag(checkoutCmd.Flags().Lookup("mount"))
+	viper.BindPFlag("library-mount", checkoutCmd.Flags().Lookup("mount"))
+}
@@ -0,0 +1,395 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// cleanupTask is everything that has to be undone when we're finished
+// with a set of credentials. Tasks are saved before they're needed, so if
+// breakglass is killed they can be finished the next time it runs
+type cleanupTask struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Vault   string    `json:"vault"`
+	Created time.Time `json:"created"`
+
+	// vault lease to revoke
+	LeaseID string `json:"lease_id,omitempty"`
+
+	// IAM login profile to delete, and the credentials to delete it with
+	LoginProfileUser string `json:"login_profile_user,omitempty"`
+	AccessKey        string `json:"access_key,omitempty"`
+	SecretKey        string `json:"secret_key,omitempty"`
+
+	// profile to remove from the shared credentials file
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	Profile         string `json:"profile,omitempty"`
+
+	// temporary files holding credentials
+	Files []string `json:"files,omitempty"`
+
+	// certificate to revoke
+	PKIMount     string `json:"pki_mount,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+
+	// LDAP library account to check back in
+	LibraryMount   string `json:"library_mount,omitempty"`
+	LibrarySet     string `json:"library_set,omitempty"`
+	ServiceAccount string `json:"service_account,omitempty"`
+}
+
+// empty is true if there is nothing for the task to do
+func (t cleanupTask) empty() bool {
+	return t.LeaseID == "" && t.LoginProfileUser == "" && t.Profile == "" && len(t.Files) == 0 && t.SerialNumber == "" && t.ServiceAccount == ""
+}
+
+// awsCleanupCmd represents the aws cleanup command
+var awsCleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Finish cleaning up after breakglass sessions that didn't exit cleanly",
+	Long: `If breakglass is killed before it can clean up, the login profiles,
+credential file profiles, temporary files and vault leases it created are
+left behind. They are recorded in ~/.breakglass/cleanup, and this
+command finishes removing them. It is also run automatically every time
+you log in to vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// logging in finishes any outstanding cleanup
+		getVaultClient()
+
+		if tasks := loadCleanupTasks(); len(tasks) > 0 {
+			log.Warn(len(tasks), " cleanup tasks are still outstanding, see ", cleanupDir())
+		} else {
+			log.Info("Nothing left to clean up")
+		}
+	},
+}
+
+// cleanupDir returns where outstanding cleanup tasks are saved. Each task
+// has a file of its own, so sessions running side by side never write the
+// same file
+func cleanupDir() string {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		log.Fatal("Could not find home directory: ", err)
+	}
+
+	return filepath.Join(homeDir, ".breakglass", "cleanup")
+}
+
+func loadCleanupTasks() []cleanupTask {
+	var tasks []cleanupTask
+
+	files, err := filepath.Glob(filepath.Join(cleanupDir(), "*.json"))
+
+	if err != nil {
+		return nil
+	}
+
+	for _, file := range files {
+		var task cleanupTask
+
+		data, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			// finished by another process since we listed the directory
+			continue
+		}
+
+		if err := json.Unmarshal(data, &task); err != nil {
+			log.Warn("Ignoring unreadable cleanup file ", file, ": ", err)
+			continue
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+// cleanupOwner identifies this process in the tasks it saves. It holds the
+// lock file of the same name until it exits, which tells other processes
+// it's still around to clean up after itself
+var cleanupOwner string
+var cleanupOwnerLock *os.File
+
+// saveCleanup records a cleanup task, replacing the task with the same ID
+// if there is one, and returns the task's ID
+func saveCleanup(task cleanupTask) string {
+	dir := cleanupDir()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatal("Could not save cleanup task: ", err)
+	}
+
+	if cleanupOwnerLock == nil {
+		cleanupOwner = randomToken()[:16]
+
+		lock, err := lockCleanupOwner(cleanupOwner)
+
+		if err != nil {
+			log.Fatal("Could not save cleanup task: ", err)
+		}
+
+		cleanupOwnerLock = lock
+	}
+
+	if task.ID == "" {
+		task.ID = randomToken()[:16]
+		task.Owner = cleanupOwner
+		task.Vault = viper.GetString("vault")
+		task.Created = time.Now()
+	}
+
+	data, err := json.MarshalIndent(task, "", "  ")
+
+	if err != nil {
+		log.Fatal("Error encoding cleanup task: ", err)
+	}
+
+	// write a new file and move it into place, so we never leave half a file
+	tmp, err := ioutil.TempFile(dir, task.ID+".tmp")
+
+	if err != nil {
+		log.Fatal("Could not save cleanup task: ", err)
+	}
+
+	_, err = tmp.Write(data)
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, task.ID+".json"))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Fatal("Could not save cleanup task: ", err)
+	}
+
+	return task.ID
+}
+
+// finishCleanup removes a task once it's been done
+func finishCleanup(id string) {
+	if id == "" {
+		return
+	}
+
+	if err := os.Remove(filepath.Join(cleanupDir(), id+".json")); err != nil && !os.IsNotExist(err) {
+		log.Warn("Could not remove cleanup task: ", err)
+	}
+}
+
+// runPendingCleanup finishes the tasks left behind by breakglass sessions
+// that are no longer running. A session that's still running holds its
+// owner lock, and so does another process already cleaning up after it
+func runPendingCleanup(client *api.Client) {
+	owners := map[string][]cleanupTask{}
+
+	for _, task := range loadCleanupTasks() {
+		if task.Owner != cleanupOwner {
+			owners[task.Owner] = append(owners[task.Owner], task)
+		}
+	}
+
+	// lock files left behind by sessions that finished all their tasks
+	locks, _ := filepath.Glob(filepath.Join(cleanupDir(), "*.lock"))
+
+	for _, lock := range locks {
+		owner := strings.TrimSuffix(filepath.Base(lock), ".lock")
+
+		if _, ok := owners[owner]; !ok && owner != cleanupOwner {
+			owners[owner] = nil
+		}
+	}
+
+	for owner, tasks := range owners {
+		lock, err := lockCleanupOwner(owner)
+
+		if err != nil {
+			// still running
+			continue
+		}
+
+		remaining := 0
+
+		for _, task := range tasks {
+			if task.Vault != viper.GetString("vault") {
+				remaining++
+				continue
+			}
+
+			log.Info("Cleaning up after breakglass session from ", task.Created.Format(time.RFC1123))
+
+			if err := runCleanupTask(client, task); err != nil {
+				log.Warn("Could not finish cleaning up, will try again next time: ", err)
+				remaining++
+				continue
+			}
+
+			finishCleanup(task.ID)
+		}
+
+		unlockCleanupOwner(lock, remaining == 0)
+	}
+}
+
+// cleanupOwnerFile returns the lock file held by a breakglass process
+// while it has cleanup tasks saved
+func cleanupOwnerFile(owner string) string {
+	return filepath.Join(cleanupDir(), owner+".lock")
+}
+
+// runCleanupTask undoes everything in task. A failure to delete the login
+// profile doesn't stop the rest, so the vault lease is always revoked, and
+// it's reported once everything else is done
+func runCleanupTask(client *api.Client, task cleanupTask) error {
+	var loginProfileErr error
+
+	if task.LoginProfileUser != "" {
+		creds := credentials.NewStaticCredentials(task.AccessKey, task.SecretKey, "")
+		svc := iam.New(session.New(), aws.NewConfig().WithCredentials(creds))
+
+		loginProfileErr = deleteLoginProfile(svc, &task.LoginProfileUser)
+
+		if loginProfileGone(loginProfileErr) {
+			loginProfileErr = nil
+		}
+
+		if loginProfileErr == nil {
+			log.Info("Login Profile removed for ", task.LoginProfileUser)
+		}
+	}
+
+	if task.Profile != "" {
+		if err := removeAWSProfile(task.CredentialsFile, task.Profile); err != nil {
+			return err
+		}
+
+		log.Info("AWS profile ", task.Profile, " removed from ", task.CredentialsFile)
+	}
+
+	if task.SerialNumber != "" {
+		_, err := client.Logical().Write(task.PKIMount+"/revoke", map[string]interface{}{
+			"serial_number": task.SerialNumber,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		log.Info("Certificate revoked: ", task.SerialNumber)
+	}
+
+	for _, file := range task.Files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		log.Info("Removed ", file)
+	}
+
+	if task.ServiceAccount != "" {
+		if err := checkInAccount(client, task.LibraryMount, task.LibrarySet, task.ServiceAccount); err != nil {
+			return err
+		}
+
+		log.Info("Checked in ", task.ServiceAccount)
+	}
+
+	if task.LeaseID != "" {
+		if err := client.Sys().Revoke(task.LeaseID); err != nil {
+			return err
+		}
+
+		log.Info("Vault Lease revoked: ", task.LeaseID)
+	}
+
+	return loginProfileErr
+}
+
+// loginProfileGone is true if deleting a login profile failed because there
+// is nothing left to delete. Either it was deleted before we were killed, or
+// the credentials we'd delete it with have expired, which means the IAM
+// user they belonged to is gone along with its login profile
+func loginProfileGone(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case iam.ErrCodeNoSuchEntityException, "InvalidClientTokenId", "ExpiredToken":
+		return true
+	}
+
+	return false
+}
+
+// deleteLoginProfile deletes an IAM login profile, waiting for it to
+// become available if it's only just been created
+func deleteLoginProfile(svc *iam.IAM, userName *string) error {
+	for {
+		_, err := svc.DeleteLoginProfile(&iam.DeleteLoginProfileInput{
+			UserName: userName,
+		})
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "EntityTemporarilyUnmodifiable" {
+			// If the Login Profile is not ready we'll see this error code
+			log.Debug("Login Profile is not available yet...")
+			time.Sleep(time.Second)
+			continue
+		}
+		return err
+	}
+}
+
+func init() {
+	awsCmd.AddCommand(awsCleanupCmd)
+}
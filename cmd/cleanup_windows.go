@@ -0,0 +1,61 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockCleanupOwner opens the lock file for owner without sharing it, so
+// opening it fails while another process has it open. Windows closes it
+// when the process exits, however it exits
+func lockCleanupOwner(owner string) (*os.File, error) {
+	path := cleanupOwnerFile(owner)
+
+	name, err := syscall.UTF16PtrFromString(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(handle), path), nil
+}
+
+// unlockCleanupOwner releases a lock, removing the file afterwards if the
+// owner has nothing left to clean up. Windows won't remove a file that's
+// still open
+func unlockCleanupOwner(file *os.File, remove bool) {
+	file.Close()
+
+	if remove {
+		os.Remove(file.Name())
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// clipboardCommands are the tools we know how to copy to the clipboard
+// with, in the order they're tried
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// copyToClipboard puts text on the clipboard. It goes through stdin, so
+// the text never shows up in a process listing
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands {
+		path, err := exec.LookPath(args[0])
+
+		if err != nil {
+			continue
+		}
+
+		// xclip and xsel fork a child that holds on to the selection, and
+		// with it any stdout or stderr pipes, so only give them stdin
+		command := exec.Command(path, args[1:]...)
+		stdin, err := command.StdinPipe()
+
+		if err != nil {
+			return err
+		}
+
+		if err := command.Start(); err != nil {
+			return fmt.Errorf("%s failed: %s", args[0], err)
+		}
+
+		if _, err := io.WriteString(stdin, text); err != nil {
+			stdin.Close()
+			command.Wait()
+			return fmt.Errorf("%s failed: %s", args[0], err)
+		}
+		stdin.Close()
+
+		if err := command.Wait(); err != nil {
+			return fmt.Errorf("%s failed: %s", args[0], err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no clipboard tool found, install one of pbcopy, wl-copy, xclip or xsel")
+}
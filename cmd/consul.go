@@ -0,0 +1,120 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var consulMount string
+var consulRole string
+
+type ConsulCredentialResp struct {
+	Token    string `mapstructure:"token"`
+	Accessor string `mapstructure:"accessor"`
+}
+
+// consulCmd represents the consul command
+var consulCmd = &cobra.Command{
+	Use:   "consul [-- consul args...]",
+	Short: "Get temporary ACL tokens for Consul clusters",
+	Long: `Gets a temporary Consul ACL token for a role from vault.
+
+Anything after -- is run as a consul command with CONSUL_HTTP_TOKEN set, and
+the token is revoked when it exits. With --exec and no command, a shell is
+started instead, so you can run as many consul commands as you need.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if consulRole == "" {
+			log.Fatal("No Consul role specified. See --help")
+		}
+
+		address := viper.GetString("consul-address")
+
+		// get vault client
+		client := getVaultClient()
+
+		secret, err := readSecret(client, consulMount+"/creds/"+consulRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", consulRole)
+		}
+
+		recordHistory("consul", consulRole)
+
+		if wrapped(secret) {
+			return
+		}
+
+		var response ConsulCredentialResp
+
+		if err := mapstructure.Decode(secret.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		env := []string{"CONSUL_HTTP_TOKEN=" + response.Token}
+
+		if address != "" {
+			env = append(env, "CONSUL_HTTP_ADDR="+address)
+		}
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running command with Consul token")
+
+			if len(args) > 0 {
+				args = append([]string{"consul"}, args...)
+			}
+
+			session := startSession(cleanupTask{LeaseID: secret.LeaseID})
+
+			execSession(client, args, env, session)
+		}
+
+		fmt.Println("Your Consul Credentials are below:")
+		fmt.Println("token: ", response.Token)
+		fmt.Println("accessor: ", response.Accessor)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(consulCmd)
+
+	consulCmd.Flags().StringVarP(&consulRole, "role", "r", "", "Consul role to get a token for")
+	consulCmd.Flags().StringVarP(&consulMount, "mount", "", "consul", "Path the Consul secrets engine is mounted at")
+	consulCmd.Flags().String("address", "", "Address of the Consul cluster, for CONSUL_HTTP_ADDR")
+	viper.BindPFlag("consul-address", consulCmd.Flags().Lookup("address"))
+}
@@ -0,0 +1,241 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how often to ask vault whether a control group request has been approved
+const controlGroupPollInterval = 5 * time.Second
+
+type ControlGroupStatusResp struct {
+	Approved      bool   `mapstructure:"approved"`
+	RequestPath   string `mapstructure:"request_path"`
+	RequestEntity struct {
+		ID   string `mapstructure:"id"`
+		Name string `mapstructure:"name"`
+	} `mapstructure:"request_entity"`
+}
+
+// readSecret reads a path from vault, waiting for a second person to
+// approve the request if the path is protected by a control group. Every
+// read is recorded in the audit log
+func readSecret(client *api.Client, path string) (*api.Secret, error) {
+	return requestSecret(client, "GET", path, nil, nil)
+}
+
+// writeSecret is the same as readSecret, but for endpoints that need a write
+func writeSecret(client *api.Client, path string, data map[string]interface{}) (*api.Secret, error) {
+	return requestSecret(client, "PUT", path, nil, data)
+}
+
+// requestSecret does the work for readSecret and writeSecret, and for reads
+// that need query parameters
+func requestSecret(client *api.Client, method string, path string, params url.Values, data map[string]interface{}) (*api.Secret, error) {
+	operation := "write"
+	if method == "GET" {
+		operation = "read"
+	}
+
+	secret, accessor, err := rawSecretRequest(client, method, path, params, data)
+
+	if err != nil {
+		auditSecret(operation, path, nil, err)
+		return nil, err
+	}
+
+	secret, err = waitForControlGroup(client, secret, accessor)
+	auditSecret(operation, path, secret, err)
+
+	return secret, err
+}
+
+// rawSecretRequest makes a request the same way Logical().Read and Write
+// do, but also returns the accessor of the wrapping token if the response
+// was wrapped. Approvers need it, and our version of the vault api doesn't
+// parse it
+func rawSecretRequest(client *api.Client, method string, path string, params url.Values, data map[string]interface{}) (*api.Secret, string, error) {
+	done := wrapCredentials(client)
+	r := client.NewRequest(method, "/v1/"+path)
+	done()
+
+	for k, v := range params {
+		r.Params[k] = v
+	}
+
+	if data != nil {
+		if err := r.SetJSONBody(data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	resp, err := client.RawRequest(r)
+
+	if resp != nil {
+		defer resp.Body.Close()
+
+		// nothing there, which Logical().Read doesn't count as an error
+		if method == "GET" && resp.StatusCode == 404 {
+			return nil, "", nil
+		}
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	// writes with nothing to say come back empty
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, "", nil
+	}
+
+	secret, err := api.ParseSecret(bytes.NewReader(body))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	var wrapped struct {
+		WrapInfo struct {
+			Accessor string `json:"accessor"`
+		} `json:"wrap_info"`
+	}
+
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, "", err
+	}
+
+	return secret, wrapped.WrapInfo.Accessor, nil
+}
+
+// wrapCredentials has vault wrap the responses to requests made on client
+// if we're handing the credentials to someone else. Only the credential
+// request itself should be wrapped, so call the function it returns as
+// soon as that's been made
+func wrapCredentials(client *api.Client) func() {
+	wrapTTL := viper.GetString("wrap-ttl")
+
+	if wrapTTL == "" {
+		return func() {}
+	}
+
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		return wrapTTL
+	})
+
+	return func() {
+		client.SetWrappingLookupFunc(nil)
+	}
+}
+
+// waitForControlGroup checks if vault handed us a wrapping token instead of
+// the secret we asked for. If it did, the path is protected by a control
+// group, so print the wrapping token's accessor for the approver, wait
+// until the request has been authorized and unwrap the real secret
+func waitForControlGroup(client *api.Client, secret *api.Secret, accessor string) (*api.Secret, error) {
+	if secret == nil || secret.WrapInfo == nil {
+		return secret, nil
+	}
+
+	// we asked for this response to be wrapped, so hand it back as is
+	if viper.GetString("wrap-ttl") != "" {
+		return secret, nil
+	}
+
+	wrapInfo := secret.WrapInfo
+
+	// use stderr, in case our output is being captured by another tool
+	fmt.Fprintln(os.Stderr, "This request requires approval from a second person.")
+	fmt.Fprintln(os.Stderr, "Ask an approver to run the following command:")
+	fmt.Fprintf(os.Stderr, "\n  breakglass approve %s\n\n", accessor)
+
+	log.WithFields(log.Fields{"accessor": accessor,
+		"path": wrapInfo.CreationPath,
+		"ttl":  wrapInfo.TTL}).Debug("waiting for control group approval")
+
+	timeout := viper.GetDuration("approval-timeout")
+	started := time.Now()
+
+	log.Info("Waiting for approval...")
+	for {
+		status, err := controlGroupStatus(client, accessor)
+
+		if err != nil {
+			return nil, fmt.Errorf("error checking approval status: %s", err)
+		}
+
+		if status.Approved {
+			break
+		}
+
+		if timeout > 0 && time.Since(started) > timeout {
+			return nil, fmt.Errorf("request was not approved within %s", timeout)
+		}
+
+		log.Debug("Request is not approved yet...")
+		time.Sleep(controlGroupPollInterval)
+	}
+	log.Info("Request approved. Retrieving credentials...")
+
+	return client.Logical().Unwrap(wrapInfo.Token)
+}
+
+// controlGroupStatus asks vault about the state of a control group request
+func controlGroupStatus(client *api.Client, accessor string) (*ControlGroupStatusResp, error) {
+	secret, err := client.Logical().Write("sys/control-group/request", map[string]interface{}{
+		"accessor": accessor,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		return nil, fmt.Errorf("no status returned for accessor %s", accessor)
+	}
+
+	var response ControlGroupStatusResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
@@ -21,47 +21,90 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	//"github.com/davecgh/go-spew/spew"
-	//"github.com/mitchellh/mapstructure"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-//type TLSCredentialResp struct {
-//	IssuingCA  string `mapstructure:"issuing_ca"`
-//	PrivateKey string `mapstructure:"private_key"`
-//	CAChain    string `mapstructure:"ca_chain"`
-//	Cert       string `mapstructure:"certificate"`
-//}
+var dockerHost string
+var dockerCommonName string
+var dockerAltNames []string
+var dockerIPSANs []string
+var dockerTTL string
+var dockerForce bool
+var dockerPort int
+var dockerContext string
 
 // dockerCmd represents the docker command
 var dockerCmd = &cobra.Command{
-	Use:   "docker",
+	Use:   "docker [-- command args...]",
 	Short: "Get temporary TLS credentials for docker daemon",
-	Long:  `Will grab a TLS cert from the Vault PKI, and then use it to connect to a Docker Daemon on a remote host you specify`,
+	Long: `Will grab a TLS cert from the Vault PKI, and then use it to connect to a Docker Daemon on a remote host you specify.
+
+The certs are written to ~/.docker/<host>, which you can use as DOCKER_CERT_PATH.
+With --context a docker context is created for the host as well.
+
+With --exec, or a command after --, the command is run with DOCKER_HOST,
+DOCKER_TLS_VERIFY and DOCKER_CERT_PATH set, and the certs are revoked and
+removed when it exits.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		// setup debug
 		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
 
 		if debug == true {
 			log.SetLevel(log.DebugLevel)
 		}
 
+		execDocker := execConn || len(args) > 0
+
+		if dockerHost == "" && (execDocker || dockerContext != "") {
+			log.Fatal("No docker host specified. See --help")
+		}
+
 		// get vault client
 		client := getVaultClient()
 
-		options := map[string]interface{}{
-			"format":      "pem",
-			"common_name": "lbriggs-test",
+		// default to a cert for the user we logged in as
+		if dockerCommonName == "" {
+			dockerCommonName = viper.GetString("username")
+		}
+
+		req := issuedCert{
+			Mount:      viper.GetString("docker-mount"),
+			Role:       viper.GetString("docker-role"),
+			CommonName: dockerCommonName,
+			AltNames:   dockerAltNames,
+			IPSANs:     dockerIPSANs,
+			TTL:        dockerTTL,
+		}
+
+		// make sure there's somewhere to put the cert before issuing it
+		if !execDocker {
+			certDir, err := dockerCertPath(dockerHost)
+
+			if err != nil {
+				log.Fatal("Could not find docker cert directory: ", err)
+			}
+
+			if err := checkCertFiles(dockerCertFiles(certDir), dockerForce); err != nil {
+				log.Fatal("Error writing certs: ", err)
+			}
 		}
 
-		docker, err := client.Logical().Write("ca/issue/docker", options)
+		docker, response, err := issueCert(client, req)
 
 		//dump.Dump(docker.Data["issuing_ca"])
 
@@ -69,47 +112,158 @@ var dockerCmd = &cobra.Command{
 			log.Fatal("Error getting credentials: ", err)
 		}
 
-		homeDir, err := homedir.Dir()
+		if wrapped(docker) {
+			return
+		}
+
+		// with --exec the certs only live as long as the command, so they
+		// go in a temporary directory
+		var certDir string
+		if execDocker {
+			certDir, err = ioutil.TempDir("", "breakglass-docker")
+		} else {
+			certDir, err = dockerCertPath(dockerHost)
+		}
 
-		certFile, err := os.Create(homeDir + "/.docker/cert.pem")
-		defer certFile.Close()
-		_, err = certFile.WriteString(docker.Data["certificate"].(string))
 		if err != nil {
-			log.Fatal("Error writing cert file to: "+homeDir+"/.docker/cert.pem\n", err)
+			log.Fatal("Could not find docker cert directory: ", err)
 		}
-		certFile.Sync()
 
-		keyFile, err := os.Create(homeDir + "/.docker/key.pem")
-		defer keyFile.Close()
-		_, err = keyFile.WriteString(docker.Data["private_key"].(string))
+		if err := os.MkdirAll(certDir, 0700); err != nil {
+			log.Fatal("Error creating cert directory "+certDir+": ", err)
+		}
 
-		if err != nil {
-			log.Fatal("Error writing key file to: "+homeDir+"/.docker/key.pem\n", err)
+		// docker wants the CA that signed the daemon's cert, which is the
+		// whole chain if there are intermediates
+		req.Files = dockerCertFiles(certDir)
+
+		// save what needs cleaning up before writing anything
+		var session cleanupTask
+		if execDocker {
+			session.PKIMount = req.Mount
+			session.SerialNumber = response.SerialNumber
+			for _, file := range req.Files {
+				session.Files = append(session.Files, file)
+			}
+			session.Files = append(session.Files, certDir)
+			session = startSession(session)
+		}
+
+		if err := writeCertFiles(req.Files, response, "", dockerForce || execDocker); err != nil {
+			log.Fatal("Error writing certs: ", err)
+		}
+
+		// keep track of the cert, so it can be renewed
+		if !execDocker {
+			req.Serial = response.SerialNumber
+			req.Issued = time.Now()
+			req.Expires, _ = certExpiry(response.Cert)
+			recordIssuedCert(req)
 		}
-		keyFile.Sync()
 
-		caFile, err := os.Create(homeDir + "/.docker/ca.pem\n")
-		defer caFile.Close()
-		var writeChain string
-		if chains, ok := docker.Data["ca_chain"].([]interface{}); ok {
-			for _, chain := range chains {
-				writeChain = chain.(string)
+		if dockerContext != "" {
+			if err := dockerUpdateContext(dockerContext, dockerAddress(), certDir); err != nil {
+				log.Fatal("Error creating docker context: ", err)
 			}
+			log.Info("Docker context " + dockerContext + " points at " + dockerAddress() + ". Use it with docker --context " + dockerContext)
 		}
-		_, err = caFile.WriteString(writeChain)
-		if err != nil {
-			log.Fatal("Error writing ca file to: "+homeDir+"/.docker/ca.pem", err)
+
+		if execDocker {
+			log.Info("Exec enabled, running command with docker certs")
+
+			execSession(client, args, []string{
+				"DOCKER_HOST=" + dockerAddress(),
+				"DOCKER_TLS_VERIFY=1",
+				"DOCKER_CERT_PATH=" + certDir,
+			}, session)
 		}
-		caFile.Sync()
 
-		log.Info("Docker keys have been generated. They have been saved " + homeDir + "/.docker")
-		log.Info("You should now be able to use docker -H tcp://<host>:4243 --tls to connect to your docker daemon")
+		log.Info("Docker keys have been generated. They have been saved in " + certDir)
+
+		if dockerHost == "" {
+			log.Info("You should now be able to use docker -H tcp://<host>:4243 --tls to connect to your docker daemon")
+		} else {
+			log.Info("You should now be able to use docker --tlsverify -H " + dockerAddress() + " to connect to your docker daemon")
+			log.Info("Or: export DOCKER_HOST=" + dockerAddress() + " DOCKER_TLS_VERIFY=1 DOCKER_CERT_PATH=" + certDir)
+		}
 	},
 }
 
+// dockerAddress returns the address of the docker daemon we're connecting to
+func dockerAddress() string {
+	return fmt.Sprintf("tcp://%s:%d", dockerHost, dockerPort)
+}
+
+// dockerUpdateContext creates a docker context using the certs in certDir,
+// or updates it if it already exists. Docker copies the certs into its
+// context store, so they don't need to stay in certDir
+func dockerUpdateContext(name string, address string, certDir string) error {
+	dockerPath, err := exec.LookPath("docker")
+
+	if err != nil {
+		return fmt.Errorf("docker client not found in $PATH: %s", err)
+	}
+
+	action := "create"
+	if exec.Command(dockerPath, "context", "inspect", name).Run() == nil {
+		action = "update"
+	}
+
+	endpoint := fmt.Sprintf("host=%s,ca=%s,cert=%s,key=%s", address,
+		filepath.Join(certDir, "ca.pem"),
+		filepath.Join(certDir, "cert.pem"),
+		filepath.Join(certDir, "key.pem"))
+
+	command := exec.Command(dockerPath, "context", action, name, "--docker", endpoint)
+
+	log.Debug("Running ", command.Args)
+
+	if output, err := command.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// dockerCertFiles returns where docker expects to find the parts of a cert
+// in certDir
+func dockerCertFiles(certDir string) map[string]string {
+	return map[string]string{
+		"ca":   filepath.Join(certDir, "ca.pem"),
+		"cert": filepath.Join(certDir, "cert.pem"),
+		"key":  filepath.Join(certDir, "key.pem"),
+	}
+}
+
+// dockerCertPath returns the directory to keep the certs for a docker host
+// in. Without a host, the default docker cert directory is used
+func dockerCertPath(host string) (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		return filepath.Join(homeDir, ".docker"), nil
+	}
+
+	return filepath.Join(homeDir, ".docker", host), nil
+}
+
 func init() {
 	RootCmd.AddCommand(dockerCmd)
 
-	// dockerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
+	dockerCmd.Flags().StringVarP(&dockerHost, "host", "H", "", "Docker host to get certs for. They are saved in ~/.docker/<host>")
+	dockerCmd.Flags().StringVarP(&dockerCommonName, "cn", "", "", "Common name for the cert (default is your vault username)")
+	dockerCmd.Flags().StringSliceVarP(&dockerAltNames, "alt-names", "", nil, "Subject alternative names for the cert")
+	dockerCmd.Flags().StringSliceVarP(&dockerIPSANs, "ip-sans", "", nil, "IP subject alternative names for the cert")
+	dockerCmd.Flags().StringVarP(&dockerTTL, "ttl", "", "", "How long the cert should be valid for")
+	dockerCmd.Flags().BoolVarP(&dockerForce, "force", "f", false, "Replace existing certs")
+	dockerCmd.Flags().IntVarP(&dockerPort, "docker-port", "", 4243, "Port the docker daemon listens on")
+	dockerCmd.Flags().StringVarP(&dockerContext, "context", "", "", "Create or update a docker context with this name for the host")
+	dockerCmd.Flags().String("mount", "ca", "Path the PKI backend is mounted at")
+	dockerCmd.Flags().String("role", "docker", "PKI role to issue the cert with")
+	viper.BindPFlag("docker-mount", dockerCmd.Flags().Lookup("mount"))
+	viper.BindPFlag("docker-role", dockerCmd.Flags().Lookup("role"))
 }
@@ -0,0 +1,90 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// runWithEnv runs a command with extra environment variables, such as
+// credentials, and returns its exit code. If no command is given, the
+// user's shell is started. Signals we receive are passed on to the
+// command, so that we're still around to clean up after it exits
+func runWithEnv(args []string, env []string) int {
+	if len(args) == 0 {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		args = []string{shell}
+	}
+
+	path, err := exec.LookPath(args[0])
+
+	if err != nil {
+		log.Error(args[0], " not found in $PATH: ", err)
+		return 127
+	}
+
+	command := exec.Command(path, args[1:]...)
+	command.Env = append(os.Environ(), env...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	log.Debug("Running ", args)
+
+	if err := command.Start(); err != nil {
+		log.Error("Error running ", args[0], ": ", err)
+		return 1
+	}
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(c)
+
+	go func() {
+		for sig := range c {
+			command.Process.Signal(sig)
+		}
+	}()
+
+	err = command.Wait()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+		return 1
+	}
+
+	if err != nil {
+		log.Error("Error running ", args[0], ": ", err)
+		return 1
+	}
+
+	return 0
+}
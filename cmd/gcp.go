@@ -0,0 +1,225 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var gcpMount string
+var gcpRoleset string
+var gcpCredentialType string
+var gcpKeyFile string
+
+type GCPTokenResp struct {
+	Token            string `mapstructure:"token"`
+	ExpiresAtSeconds int64  `mapstructure:"expires_at_seconds"`
+}
+
+type GCPKeyResp struct {
+	PrivateKeyData string `mapstructure:"private_key_data"`
+	KeyAlgorithm   string `mapstructure:"key_algorithm"`
+	KeyType        string `mapstructure:"key_type"`
+}
+
+// gcpCmd represents the gcp command
+var gcpCmd = &cobra.Command{
+	Use:   "gcp [-- command args...]",
+	Short: "Get temporary credentials for Google Cloud",
+	Long: `Gets an OAuth access token or a service account key for a Google Cloud
+roleset from vault.
+
+Service account keys can be written to a file for GOOGLE_APPLICATION_CREDENTIALS.
+They are kept until you hit Ctrl-C, when the key is revoked and the file
+removed. With --exec, or a command after --, the command is run with the credentials
+in its environment, and service account keys are revoked when it exits.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if gcpRoleset == "" {
+			log.Fatal("No GCP roleset specified. See --help")
+		}
+
+		if gcpCredentialType != "token" && gcpCredentialType != "key" {
+			log.Fatal("Unknown credential type: ", gcpCredentialType)
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		path := gcpMount + "/" + gcpCredentialType + "/" + gcpRoleset
+
+		log.Debug("Reading Vault path: ", path)
+
+		secret, err := readSecret(client, path)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check this roleset exists in vault: ", gcpRoleset)
+		}
+
+		recordHistory("gcp", gcpRoleset)
+
+		if wrapped(secret) {
+			return
+		}
+
+		if gcpCredentialType == "token" {
+			gcpToken(secret, args)
+		} else {
+			gcpKey(client, secret, args)
+		}
+	},
+}
+
+// gcpToken prints an OAuth access token, or runs a command with it
+func gcpToken(secret *api.Secret, args []string) {
+	var response GCPTokenResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		log.Fatal("Error parsing vault's credential response: ", err)
+	}
+
+	if execConn || len(args) > 0 {
+		log.Info("Exec enabled, running command with GCP access token")
+
+		// tokens can't be revoked, they just expire
+		os.Exit(runWithEnv(args, []string{
+			"CLOUDSDK_AUTH_ACCESS_TOKEN=" + response.Token,
+			"GOOGLE_OAUTH_ACCESS_TOKEN=" + response.Token,
+		}))
+	}
+
+	fmt.Println("Your GCP access token is below:")
+	fmt.Println("token: ", response.Token)
+	fmt.Println("expires: ", time.Unix(response.ExpiresAtSeconds, 0).Format(time.RFC1123))
+}
+
+// gcpKey writes a service account key to a file, or runs a command with it
+func gcpKey(client *api.Client, secret *api.Secret, args []string) {
+	var response GCPKeyResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		log.Fatal("Error parsing vault's credential response: ", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(response.PrivateKeyData)
+
+	if err != nil {
+		log.Fatal("Error decoding service account key: ", err)
+	}
+
+	if execConn || len(args) > 0 {
+		log.Info("Exec enabled, running command with GCP service account key")
+
+		keyFile, err := writeTempFile("breakglass-gcp", key)
+
+		if err != nil {
+			log.Fatal("Error writing service account key: ", err)
+		}
+
+		session := startSession(cleanupTask{LeaseID: secret.LeaseID, Files: []string{keyFile}})
+
+		execSession(client, args, []string{
+			"GOOGLE_APPLICATION_CREDENTIALS=" + keyFile,
+			"CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE=" + keyFile,
+		}, session)
+	}
+
+	// never replace a file that's already there, it may well hold other
+	// credentials, and we'd remove it when we're done
+	var files []string
+	if gcpKeyFile != "" {
+		if err := writeKeyFile(gcpKeyFile, key); err != nil {
+			client.Sys().Revoke(secret.LeaseID)
+			log.Fatal("Error writing service account key: ", err)
+		}
+		files = []string{gcpKeyFile}
+	}
+
+	// hold on to the key until we're done with it, then revoke it
+	session := startSession(cleanupTask{LeaseID: secret.LeaseID, Files: files})
+
+	if gcpKeyFile == "" {
+		fmt.Println(string(key))
+	} else {
+		fmt.Println("Your GCP service account key has been written to ", gcpKeyFile)
+		fmt.Printf("Use it with: export GOOGLE_APPLICATION_CREDENTIALS=%s\n", gcpKeyFile)
+	}
+
+	waitForInterrupt()
+
+	endSession(client, session)
+}
+
+// writeKeyFile writes a service account key to a new file only we can
+// read. If the file already exists it's left alone
+func writeKeyFile(path string, key []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(key); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(gcpCmd)
+
+	gcpCmd.Flags().StringVarP(&gcpRoleset, "roleset", "r", "", "GCP roleset to get credentials for")
+	gcpCmd.Flags().StringVarP(&gcpCredentialType, "type", "t", "token", "Type of credentials to get: token or key")
+	gcpCmd.Flags().StringVarP(&gcpMount, "mount", "", "gcp", "Path the GCP secrets engine is mounted at")
+	gcpCmd.Flags().StringVarP(&gcpKeyFile, "key-file", "", "", "Write the service account key to this new file instead of printing it")
+}
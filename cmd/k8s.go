@@ -0,0 +1,200 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var k8sMount string
+var k8sRole string
+var k8sNamespace string
+var k8sTTL string
+
+type KubernetesCredentialResp struct {
+	Token     string `mapstructure:"service_account_token"`
+	Name      string `mapstructure:"service_account_name"`
+	Namespace string `mapstructure:"service_account_namespace"`
+}
+
+// kubeconfig is the subset of a kubeconfig file we need to write. kubectl
+// reads JSON kubeconfigs just as well as YAML ones
+type kubeconfig struct {
+	APIVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	CurrentContext string            `json:"current-context"`
+	Clusters       []kubeconfigNamed `json:"clusters"`
+	Users          []kubeconfigNamed `json:"users"`
+	Contexts       []kubeconfigNamed `json:"contexts"`
+}
+
+type kubeconfigNamed struct {
+	Name    string                 `json:"name"`
+	Cluster map[string]interface{} `json:"cluster,omitempty"`
+	User    map[string]interface{} `json:"user,omitempty"`
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// k8sCmd represents the k8s command
+var k8sCmd = &cobra.Command{
+	Use:   "k8s [-- command args...]",
+	Short: "Get temporary Kubernetes credentials",
+	Long: `Gets a temporary service account token for a Kubernetes role from vault,
+and writes a kubeconfig that uses it.
+
+With --exec, or a command after --, the command (or your shell) is run with
+KUBECONFIG set. Otherwise breakglass waits for Ctrl-C. Either way the token is
+revoked and the kubeconfig removed at the end.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if k8sRole == "" {
+			log.Fatal("No Kubernetes role specified. See --help")
+		}
+
+		server := viper.GetString("k8s-server")
+
+		if server == "" {
+			log.Fatal("No Kubernetes API server specified. See --help")
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		options := map[string]interface{}{
+			"kubernetes_namespace": k8sNamespace,
+		}
+
+		if k8sTTL != "" {
+			options["ttl"] = k8sTTL
+		}
+
+		secret, err := writeSecret(client, k8sMount+"/creds/"+k8sRole, options)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", k8sRole)
+		}
+
+		recordHistory("k8s", k8sRole)
+
+		if wrapped(secret) {
+			return
+		}
+
+		var response KubernetesCredentialResp
+
+		if err := mapstructure.Decode(secret.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		log.Debug("Service account is: ", response.Namespace, "/", response.Name)
+
+		config, err := k8sConfig(server, viper.GetString("k8s-ca-file"), response)
+
+		if err != nil {
+			log.Fatal("Error creating kubeconfig: ", err)
+		}
+
+		configFile, err := writeTempFile("breakglass-kubeconfig", config)
+
+		if err != nil {
+			log.Fatal("Error writing kubeconfig: ", err)
+		}
+
+		session := startSession(cleanupTask{LeaseID: secret.LeaseID, Files: []string{configFile}})
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running command with Kubernetes credentials")
+
+			execSession(client, args, []string{"KUBECONFIG=" + configFile}, session)
+		}
+
+		fmt.Println("Your Kubernetes credentials have been written to ", configFile)
+		fmt.Printf("Use them with: export KUBECONFIG=%s\n", configFile)
+
+		waitForInterrupt()
+
+		endSession(client, session)
+	},
+}
+
+// k8sConfig returns a kubeconfig for the service account token
+func k8sConfig(server string, caFile string, creds KubernetesCredentialResp) ([]byte, error) {
+	cluster := map[string]interface{}{
+		"server": server,
+	}
+
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cluster["certificate-authority-data"] = base64.StdEncoding.EncodeToString(ca)
+	}
+
+	context := map[string]interface{}{
+		"cluster":   "breakglass",
+		"user":      "breakglass",
+		"namespace": creds.Namespace,
+	}
+
+	return json.MarshalIndent(kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		CurrentContext: "breakglass",
+		Clusters:       []kubeconfigNamed{{Name: "breakglass", Cluster: cluster}},
+		Users:          []kubeconfigNamed{{Name: "breakglass", User: map[string]interface{}{"token": creds.Token}}},
+		Contexts:       []kubeconfigNamed{{Name: "breakglass", Context: context}},
+	}, "", "  ")
+}
+
+func init() {
+	RootCmd.AddCommand(k8sCmd)
+
+	k8sCmd.Flags().StringVarP(&k8sRole, "role", "r", "", "Kubernetes role to get credentials for")
+	k8sCmd.Flags().StringVarP(&k8sNamespace, "kube-namespace", "n", "default", "Kubernetes namespace to get credentials for")
+	k8sCmd.Flags().StringVarP(&k8sTTL, "ttl", "", "", "How long the service account token should be valid for")
+	k8sCmd.Flags().StringVarP(&k8sMount, "mount", "", "kubernetes", "Path the Kubernetes secrets engine is mounted at")
+	k8sCmd.Flags().String("server", "", "URL of the Kubernetes API server")
+	k8sCmd.Flags().String("ca-file", "", "CA certificate of the Kubernetes API server")
+	viper.BindPFlag("k8s-server", k8sCmd.Flags().Lookup("server"))
+	viper.BindPFlag("k8s-ca-file", k8sCmd.Flags().Lookup("ca-file"))
+}
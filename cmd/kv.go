@@ -0,0 +1,231 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var kvVersion int
+var kvField string
+var kvClip bool
+
+// kvCmd represents the kv command
+var kvCmd = &cobra.Command{
+	Use:   "kv",
+	Short: "Get static secrets from a vault KV backend",
+	Long: `Reads static secrets, like the root passwords for switches and BMCs, from
+vault's KV backend. Both versions of the backend are supported, and the
+version is worked out from the mount`,
+}
+
+var kvGetCmd = &cobra.Command{
+	Use:   "get <path>",
+	Short: "Get a secret",
+	Long: `Gets the secret at path, for example secret/network/core-switch-1.
+
+--field prints a single field on its own, and --clip copies it to the
+clipboard instead of printing it. --version reads an older version of a
+secret from a KV version 2 backend.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No secret path specified. See --help")
+		}
+
+		path := strings.Trim(args[0], "/")
+
+		// get vault client
+		client := getVaultClient()
+
+		data := kvGet(client, path, kvVersion)
+
+		if data == nil {
+			return
+		}
+
+		if kvField == "" && kvClip {
+			if len(data) != 1 {
+				log.Fatal("The secret has more than one field, pick one to copy with --field")
+			}
+			for k := range data {
+				kvField = k
+			}
+		}
+
+		if kvField != "" {
+			value, ok := data[kvField]
+
+			if !ok {
+				log.Fatal("No field ", kvField, " in ", path)
+			}
+
+			if kvClip {
+				if err := copyToClipboard(fmt.Sprint(value)); err != nil {
+					log.Fatal("Error copying to clipboard: ", err)
+				}
+				log.Info("Copied " + kvField + " to the clipboard")
+				return
+			}
+
+			fmt.Println(value)
+			return
+		}
+
+		var keys []string
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Println("Your Credentials are below:")
+		for _, k := range keys {
+			fmt.Printf(" %s: %v\n", k, data[k])
+		}
+	},
+}
+
+// kvGet reads the secret at path from whichever version of the KV backend
+// it's in, and returns its fields. It returns nil if the secret was wrapped
+// for someone else
+func kvGet(client *api.Client, path string, version int) map[string]interface{} {
+	mount, kv, err := kvMount(client, path)
+
+	if err != nil {
+		log.Fatal("Error finding KV backend for ", path, ": ", err)
+	}
+
+	log.WithFields(log.Fields{"mount": mount,
+		"version": kv}).Debug("found kv backend")
+
+	if kv < 2 && version != 0 {
+		log.Fatal(mount, " is a KV version 1 backend, which doesn't keep old versions")
+	}
+
+	var secret *api.Secret
+	if kv < 2 {
+		secret, err = readSecret(client, path)
+	} else {
+		secret, err = kvReadVersion(client, mount+"/data/"+strings.TrimPrefix(path, mount+"/"), version)
+	}
+
+	if err != nil {
+		log.Fatal("Error reading secret: ", err)
+	}
+
+	if secret == nil {
+		log.Fatal("No secret found at ", path)
+	}
+
+	if wrapped(secret) {
+		return nil
+	}
+
+	if kv < 2 {
+		return secret.Data
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+
+	if data == nil {
+		log.Fatal("This version of ", path, " has been deleted")
+	}
+
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		log.Debug("secret version is: ", metadata["version"])
+	}
+
+	return data
+}
+
+// kvMount finds the KV backend path is in, and which version of the
+// backend it is, from the mount options. It asks with the endpoint the
+// vault CLI uses for the same thing, which anyone who can read the secret
+// is allowed to use. Vaults too old to have it are too old for version 2
+// of the backend too
+func kvMount(client *api.Client, path string) (string, int, error) {
+	secret, err := client.Logical().Read("sys/internal/ui/mounts/" + path)
+
+	if err != nil || secret == nil {
+		log.Debug("Could not look up mount, assuming KV version 1: ", err)
+		return strings.SplitN(path, "/", 2)[0], 1, nil
+	}
+
+	mount, _ := secret.Data["path"].(string)
+
+	options := map[string]string{}
+	if raw, ok := secret.Data["options"].(map[string]interface{}); ok {
+		for k, v := range raw {
+			options[k] = fmt.Sprint(v)
+		}
+	}
+
+	return strings.TrimSuffix(mount, "/"), kvOptionsVersion(options), nil
+}
+
+// kvOptionsVersion returns the KV version from a mount's options. Mounts
+// without a version are version 1
+func kvOptionsVersion(options map[string]string) int {
+	version, err := strconv.Atoi(options["version"])
+
+	if err != nil {
+		return 1
+	}
+
+	return version
+}
+
+// kvReadVersion reads a KV version 2 secret. Version 0 is the latest
+func kvReadVersion(client *api.Client, path string, version int) (*api.Secret, error) {
+	if version == 0 {
+		return readSecret(client, path)
+	}
+
+	// the version has to go in the query string, which Logical().Read
+	// can't do
+	return requestSecret(client, "GET", path, url.Values{"version": []string{strconv.Itoa(version)}}, nil)
+}
+
+func init() {
+	RootCmd.AddCommand(kvCmd)
+	kvCmd.AddCommand(kvGetCmd)
+
+	kvGetCmd.Flags().IntVarP(&kvVersion, "version", "", 0, "Version of the secret to read (KV version 2 only, default is the latest)")
+	kvGetCmd.Flags().StringVarP(&kvField, "field", "", "", "Only print this field")
+	kvGetCmd.Flags().BoolVarP(&kvClip, "clip", "c", false, "Copy the field to the clipboard instead of printing it")
+}
@@ -0,0 +1,290 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the hosts and roles you can get credentials for",
+	Long: `Looks at the backends mounted in vault and lists the hosts and roles
+in them. Only the ones your vault token is allowed to get credentials
+for are shown.`,
+}
+
+var listMySQLCmd = &cobra.Command{
+	Use:   "mysql",
+	Short: "List MySQL hosts and roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := listSetup()
+
+		hosts, err := mysqlHosts(client)
+
+		if err != nil {
+			log.Fatal("Error listing MySQL hosts: ", err)
+		}
+
+		var failed int
+		for _, host := range hosts {
+			roles, err := readableRoles(client, "mysql/"+host, "creds", "read")
+
+			// one host we can't see into shouldn't hide the rest
+			if err != nil {
+				log.Warn("Error listing roles for ", host, ": ", err)
+				failed++
+				continue
+			}
+
+			if len(roles) > 0 {
+				fmt.Printf("%s: %s\n", host, strings.Join(roles, ", "))
+			}
+		}
+
+		if failed > 0 && failed == len(hosts) {
+			log.Fatal("Could not list roles for any MySQL host")
+		}
+	},
+}
+
+var listSSHRolesCmd = &cobra.Command{
+	Use:   "ssh-roles",
+	Short: "List SSH roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := listSetup()
+
+		roles, err := readableRoles(client, "ssh", "creds", "update")
+
+		if err != nil {
+			log.Fatal("Error listing SSH roles: ", err)
+		}
+
+		for _, role := range roles {
+			fmt.Println(role)
+		}
+	},
+}
+
+var listAWSRolesCmd = &cobra.Command{
+	Use:   "aws-roles",
+	Short: "List AWS roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := listSetup()
+
+		mounts, err := mountsOfType(client, "aws")
+
+		if err != nil {
+			log.Fatal("Error listing AWS backends: ", err)
+		}
+
+		var failed int
+		for _, mount := range mounts {
+			roles, err := readableRoles(client, mount, "creds", "read")
+
+			if err != nil {
+				log.Warn("Error listing roles for ", mount, ": ", err)
+				failed++
+				continue
+			}
+
+			// print the path, as that's what --role expects
+			for _, role := range roles {
+				fmt.Println(mount + "/creds/" + role)
+			}
+		}
+
+		if failed > 0 && failed == len(mounts) {
+			log.Fatal("Could not list roles for any AWS backend")
+		}
+	},
+}
+
+var listPKIRolesCmd = &cobra.Command{
+	Use:   "pki-roles",
+	Short: "List PKI roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		client := listSetup()
+
+		mounts, err := mountsOfType(client, "pki")
+
+		if err != nil {
+			log.Fatal("Error listing PKI backends: ", err)
+		}
+
+		var failed int
+		for _, mount := range mounts {
+			roles, err := readableRoles(client, mount, "issue", "update")
+
+			if err != nil {
+				log.Warn("Error listing roles for ", mount, ": ", err)
+				failed++
+				continue
+			}
+
+			if len(roles) > 0 {
+				fmt.Printf("%s: %s\n", mount, strings.Join(roles, ", "))
+			}
+		}
+
+		if failed > 0 && failed == len(mounts) {
+			log.Fatal("Could not list roles for any PKI backend")
+		}
+	},
+}
+
+// listSetup does the common setup for the list subcommands
+func listSetup() *api.Client {
+	// setup debug
+	debug = viper.GetBool("debug")
+
+	if debug == true {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	return getVaultClient()
+}
+
+// mountsOfType returns the paths of all the mounts of a backend type,
+// without the trailing slash
+func mountsOfType(client *api.Client, backend string) ([]string, error) {
+	mounts, err := client.Sys().ListMounts()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for path, mount := range mounts {
+		if mount.Type == backend {
+			paths = append(paths, strings.TrimSuffix(path, "/"))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// mysqlHosts returns the hosts mounted under mysql/
+func mysqlHosts(client *api.Client) ([]string, error) {
+	mounts, err := client.Sys().ListMounts()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for path := range mounts {
+		if strings.HasPrefix(path, "mysql/") {
+			hosts = append(hosts, strings.Trim(strings.TrimPrefix(path, "mysql/"), "/"))
+		}
+	}
+	sort.Strings(hosts)
+
+	return hosts, nil
+}
+
+// listRoles returns the names of the roles configured in a mount
+func listRoles(client *api.Client, mount string) ([]string, error) {
+	secret, err := client.Logical().List(mount + "/roles")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		return nil, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+
+	var roles []string
+	for _, key := range keys {
+		roles = append(roles, fmt.Sprint(key))
+	}
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+// readableRoles returns the roles in a mount which our token has the
+// capability to get credentials for at <mount>/<endpoint>/<role>
+func readableRoles(client *api.Client, mount string, endpoint string, capability string) ([]string, error) {
+	roles, err := listRoles(client, mount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var readable []string
+	for _, role := range roles {
+		path := mount + "/" + endpoint + "/" + role
+
+		allowed, err := hasCapability(client, path, capability)
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{"path": path,
+			"allowed": allowed}).Debug("checked capabilities")
+
+		if allowed {
+			readable = append(readable, role)
+		}
+	}
+
+	return readable, nil
+}
+
+// hasCapability checks if our token has a capability on a path
+func hasCapability(client *api.Client, path string, capability string) (bool, error) {
+	capabilities, err := client.Sys().CapabilitiesSelf(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range capabilities {
+		if c == capability || c == "root" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func init() {
+	RootCmd.AddCommand(listCmd)
+	listCmd.AddCommand(listMySQLCmd)
+	listCmd.AddCommand(listSSHRolesCmd)
+	listCmd.AddCommand(listAWSRolesCmd)
+	listCmd.AddCommand(listPKIRolesCmd)
+}
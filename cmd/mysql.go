@@ -26,6 +26,7 @@ import (
 	"os/exec"
 
 	//"github.com/acidlemon/go-dumper"
+	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -63,16 +64,20 @@ and returns a user name and password you can use to login`,
 		}
 
 		// check specific info
-		if mysqlHost == "" {
+		if mysqlHost == "" && !isInteractive() {
 			log.Fatal("No MySQL host specified. See --help")
 		}
 
-		log.Debug("mysql host is: ", mysqlHost)
-
 		// get vault client
 		client := getVaultClient()
 
-		mysql, err := client.Logical().Read("mysql/" + mysqlHost + "/creds/" + mysqlRole)
+		if mysqlHost == "" {
+			mysqlHost = pickMySQLHost(client)
+		}
+
+		log.Debug("mysql host is: ", mysqlHost)
+
+		mysql, err := readSecret(client, "mysql/"+mysqlHost+"/creds/"+mysqlRole)
 
 		if err != nil {
 			log.Fatal("Error getting credentials: ", err)
@@ -82,42 +87,85 @@ and returns a user name and password you can use to login`,
 			log.Fatal("No credentials were retrieved. Check this host is enabled in vault: ", mysqlHost)
 		}
 
-		var response MySQLCredentialResp
+		recordHistory("mysql", mysqlHost)
 
-		if err := mapstructure.Decode(mysql.Data, &response); err != nil {
-			log.Fatal("Error parsing vault's credential response: ", err)
+		if wrapped(mysql) {
+			return
 		}
 
-		fmt.Printf("Your MySQL Credentials are below\n username: %s\n password: %s\n", response.Username, response.Password)
+		mysqlConnect(mysqlHost, mysql)
 
-		if execConn == true {
-			log.Info("Exec enabled, establishing connection")
+		//dump.Dump(mysql.Data)
+
+	},
+}
 
-			mysqlCmdPath, err := exec.LookPath("mysql")
+// pickMySQLHost asks the user which of the mysql hosts they can get
+// credentials for they want to use
+func pickMySQLHost(client *api.Client) string {
+	hosts, err := mysqlHosts(client)
 
-			if err != nil {
-				log.Fatal("mysql client not found in $PATH, can't establish connection", err)
-			}
+	if err != nil {
+		log.Fatal("Error listing MySQL hosts: ", err)
+	}
 
-			mysqlCmdArgs = append(mysqlCmdArgs, []string{"-h", mysqlHost, "-u", string(response.Username), "--password=" + string(response.Password)}...)
-			mysqlCommand = exec.Command(mysqlCmdPath, mysqlCmdArgs...)
+	var candidates []string
+	for _, host := range hosts {
+		allowed, err := hasCapability(client, "mysql/"+host+"/creds/"+mysqlRole, "read")
 
-			log.Debug("Initiating MySQL Connection", mysqlCommand)
+		if err != nil {
+			log.Fatal("Error checking access to ", host, ": ", err)
+		}
 
-			mysqlCommand.Stdin = os.Stdin
-			mysqlCommand.Stdout = os.Stdout
+		if allowed {
+			candidates = append(candidates, host)
+		}
+	}
 
-			err = mysqlCommand.Run()
+	host, err := pick("mysql", "Select a MySQL host", candidates, false)
 
-			if err != nil {
-				log.Fatal("Error creating mysql connection: ", err)
-			}
+	if err != nil {
+		log.Fatal("No MySQL host selected: ", err)
+	}
 
+	return host
+}
+
+// mysqlConnect prints the mysql credentials in secret, and connects to host
+// with them if --exec was given
+func mysqlConnect(host string, secret *api.Secret) {
+	var response MySQLCredentialResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		log.Fatal("Error parsing vault's credential response: ", err)
+	}
+
+	fmt.Printf("Your MySQL Credentials are below\n username: %s\n password: %s\n", response.Username, response.Password)
+
+	if execConn == true {
+		log.Info("Exec enabled, establishing connection")
+
+		mysqlCmdPath, err := exec.LookPath("mysql")
+
+		if err != nil {
+			log.Fatal("mysql client not found in $PATH, can't establish connection", err)
 		}
 
-		//dump.Dump(mysql.Data)
+		mysqlCmdArgs = append(mysqlCmdArgs, []string{"-h", host, "-u", string(response.Username), "--password=" + string(response.Password)}...)
+		mysqlCommand = exec.Command(mysqlCmdPath, mysqlCmdArgs...)
 
-	},
+		log.Debug("Initiating MySQL Connection", mysqlCommand)
+
+		mysqlCommand.Stdin = os.Stdin
+		mysqlCommand.Stdout = os.Stdout
+
+		err = mysqlCommand.Run()
+
+		if err != nil {
+			log.Fatal("Error creating mysql connection: ", err)
+		}
+
+	}
 }
 
 func init() {
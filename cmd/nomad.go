@@ -0,0 +1,120 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var nomadMount string
+var nomadRole string
+
+type NomadCredentialResp struct {
+	SecretID   string `mapstructure:"secret_id"`
+	AccessorID string `mapstructure:"accessor_id"`
+}
+
+// nomadCmd represents the nomad command
+var nomadCmd = &cobra.Command{
+	Use:   "nomad [-- nomad args...]",
+	Short: "Get temporary ACL tokens for Nomad clusters",
+	Long: `Gets a temporary Nomad ACL token for a role from vault.
+
+Anything after -- is run as a nomad command with NOMAD_TOKEN set, and
+the token is revoked when it exits. With --exec and no command, a shell is
+started instead, so you can run as many nomad commands as you need.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if nomadRole == "" {
+			log.Fatal("No Nomad role specified. See --help")
+		}
+
+		address := viper.GetString("nomad-address")
+
+		// get vault client
+		client := getVaultClient()
+
+		secret, err := readSecret(client, nomadMount+"/creds/"+nomadRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", nomadRole)
+		}
+
+		recordHistory("nomad", nomadRole)
+
+		if wrapped(secret) {
+			return
+		}
+
+		var response NomadCredentialResp
+
+		if err := mapstructure.Decode(secret.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		env := []string{"NOMAD_TOKEN=" + response.SecretID}
+
+		if address != "" {
+			env = append(env, "NOMAD_ADDR="+address)
+		}
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running command with Nomad token")
+
+			if len(args) > 0 {
+				args = append([]string{"nomad"}, args...)
+			}
+
+			session := startSession(cleanupTask{LeaseID: secret.LeaseID})
+
+			execSession(client, args, env, session)
+		}
+
+		fmt.Println("Your Nomad Credentials are below:")
+		fmt.Println("secret_id: ", response.SecretID)
+		fmt.Println("accessor_id: ", response.AccessorID)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(nomadCmd)
+
+	nomadCmd.Flags().StringVarP(&nomadRole, "role", "r", "", "Nomad role to get a token for")
+	nomadCmd.Flags().StringVarP(&nomadMount, "mount", "", "nomad", "Path the Nomad secrets engine is mounted at")
+	nomadCmd.Flags().String("address", "", "Address of the Nomad cluster, for NOMAD_ADDR")
+	viper.BindPFlag("nomad-address", nomadCmd.Flags().Lookup("address"))
+}
@@ -0,0 +1,226 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// how many recent selections to remember for each kind of target
+const historySize = 20
+
+// isInteractive returns true if stdin is a terminal, so we can ask questions
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// pick asks the user to choose one of candidates. Typing text narrows the
+// list down to the candidates that fuzzy match it, typing a number selects
+// that candidate. Recently used values for kind are shown first. If
+// allowNew is set, text that matches nothing is returned as is
+func pick(kind string, title string, candidates []string, allowNew bool) (string, error) {
+	candidates = byRecentUse(kind, candidates, allowNew)
+
+	if len(candidates) == 0 && !allowNew {
+		return "", fmt.Errorf("nothing to choose from")
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	matches := candidates
+
+	for {
+		fmt.Printf("%s (type to filter, enter a number to select):\n", title)
+		for i, c := range matches {
+			fmt.Printf(" %2d) %s\n", i+1, c)
+		}
+		fmt.Print("> ")
+
+		input, err := reader.ReadString('\n')
+
+		if err != nil {
+			return "", err
+		}
+
+		input = strings.TrimSpace(input)
+
+		if input == "" {
+			if len(matches) == 1 {
+				return matches[0], nil
+			}
+			matches = candidates
+			continue
+		}
+
+		if n, err := strconv.Atoi(input); err == nil && n > 0 && n <= len(matches) {
+			return matches[n-1], nil
+		}
+
+		filtered := fuzzyFilter(input, candidates)
+
+		switch {
+		case len(filtered) == 1:
+			return filtered[0], nil
+		case len(filtered) == 0 && allowNew:
+			return input, nil
+		case len(filtered) == 0:
+			fmt.Println("No matches for", input)
+			matches = candidates
+		default:
+			matches = filtered
+		}
+	}
+}
+
+// fuzzyFilter returns the candidates that contain all the characters of
+// query in order
+func fuzzyFilter(query string, candidates []string) []string {
+	query = strings.ToLower(query)
+
+	var matches []string
+	for _, c := range candidates {
+		remaining := query
+		for _, r := range strings.ToLower(c) {
+			if len(remaining) > 0 && r == rune(remaining[0]) {
+				remaining = remaining[1:]
+			}
+		}
+		if len(remaining) == 0 {
+			matches = append(matches, c)
+		}
+	}
+
+	return matches
+}
+
+// historyFile returns where we keep recently used targets
+func historyFile() (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".breakglass", "history.json"), nil
+}
+
+// loadHistory returns the recently used targets of each kind, most recent first
+func loadHistory() map[string][]string {
+	history := map[string][]string{}
+
+	path, err := historyFile()
+
+	if err != nil {
+		return history
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return history
+	}
+
+	if err := json.Unmarshal(data, &history); err != nil {
+		log.Debug("Ignoring unreadable history file: ", err)
+	}
+
+	return history
+}
+
+// recordHistory remembers that value was used for kind
+func recordHistory(kind string, value string) {
+	history := loadHistory()
+
+	recent := []string{value}
+	for _, v := range history[kind] {
+		if v != value && len(recent) < historySize {
+			recent = append(recent, v)
+		}
+	}
+	history[kind] = recent
+
+	path, err := historyFile()
+
+	if err != nil {
+		log.Debug("Not saving history: ", err)
+		return
+	}
+
+	data, err := json.Marshal(history)
+
+	if err != nil {
+		log.Debug("Not saving history: ", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Debug("Not saving history: ", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		log.Debug("Not saving history: ", err)
+	}
+}
+
+// byRecentUse orders candidates with the recently used ones first. If
+// includeAll is set, recently used values that aren't candidates are
+// included too, for targets which can't be listed from vault
+func byRecentUse(kind string, candidates []string, includeAll bool) []string {
+	var ordered []string
+	seen := map[string]bool{}
+
+	isCandidate := map[string]bool{}
+	for _, c := range candidates {
+		isCandidate[c] = true
+	}
+
+	for _, v := range loadHistory()[kind] {
+		if isCandidate[v] || includeAll {
+			ordered = append(ordered, v)
+			seen[v] = true
+		}
+	}
+
+	for _, c := range candidates {
+		if !seen[c] {
+			ordered = append(ordered, c)
+		}
+	}
+
+	return ordered
+}
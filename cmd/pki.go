@@ -0,0 +1,544 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/go-homedir"
+	"github.com/mitchellh/mapstructure"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type TLSCredentialResp struct {
+	IssuingCA    string   `mapstructure:"issuing_ca"`
+	PrivateKey   string   `mapstructure:"private_key"`
+	CAChain      []string `mapstructure:"ca_chain"`
+	Cert         string   `mapstructure:"certificate"`
+	SerialNumber string   `mapstructure:"serial_number"`
+}
+
+// issuedCert is a certificate breakglass issued, with everything needed
+// to issue it again. The files it was written to are keyed by what they
+// hold: cert, key, ca, bundle or p12
+type issuedCert struct {
+	Serial     string            `json:"serial"`
+	Mount      string            `json:"mount"`
+	Role       string            `json:"role"`
+	CommonName string            `json:"common_name"`
+	AltNames   []string          `json:"alt_names,omitempty"`
+	IPSANs     []string          `json:"ip_sans,omitempty"`
+	TTL        string            `json:"ttl,omitempty"`
+	KeyType    string            `json:"key_type,omitempty"`
+	KeyBits    int               `json:"key_bits,omitempty"`
+	CSR        bool              `json:"csr,omitempty"`
+	Files      map[string]string `json:"files"`
+	Issued     time.Time         `json:"issued"`
+	Expires    time.Time         `json:"expires"`
+}
+
+// issueCert gets a new certificate from vault. In CSR mode the private key
+// is generated here and never leaves the machine, otherwise vault
+// generates it
+func issueCert(client *api.Client, req issuedCert) (*api.Secret, *TLSCredentialResp, error) {
+	options := map[string]interface{}{
+		"format":      "pem",
+		"common_name": req.CommonName,
+	}
+
+	if len(req.AltNames) > 0 {
+		options["alt_names"] = strings.Join(req.AltNames, ",")
+	}
+
+	if len(req.IPSANs) > 0 {
+		options["ip_sans"] = strings.Join(req.IPSANs, ",")
+	}
+
+	if req.TTL != "" {
+		options["ttl"] = req.TTL
+	}
+
+	var privateKey string
+	var path string
+
+	if req.CSR {
+		key, err := generateKey(req.KeyType, req.KeyBits)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		csr, err := createCSR(key, req)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		privateKey, err = encodePrivateKey(key)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		options["csr"] = csr
+		path = req.Mount + "/sign/" + req.Role
+	} else {
+		if req.KeyType != "" {
+			options["key_type"] = req.KeyType
+		}
+
+		if req.KeyBits != 0 {
+			options["key_bits"] = req.KeyBits
+		}
+
+		path = req.Mount + "/issue/" + req.Role
+	}
+
+	log.WithFields(log.Fields{"path": path,
+		"common_name": req.CommonName}).Debug("issuing cert")
+
+	secret, err := writeSecret(client, path, options)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if secret == nil {
+		return nil, nil, fmt.Errorf("no certificate was issued, check the role exists in vault: %s", path)
+	}
+
+	var response TLSCredentialResp
+
+	if secret.WrapInfo != nil {
+		return secret, &response, nil
+	}
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		return nil, nil, err
+	}
+
+	if req.CSR {
+		response.PrivateKey = privateKey
+	}
+
+	return secret, &response, nil
+}
+
+// generateKey creates a private key for CSR mode. For ec keys, the key
+// size picks the curve
+func generateKey(keyType string, bits int) (crypto.Signer, error) {
+	switch keyType {
+	case "", "rsa":
+		if bits == 0 {
+			bits = 2048
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ec":
+		switch bits {
+		case 0, 256:
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case 384:
+			return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		case 521:
+			return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+		}
+		return nil, fmt.Errorf("unsupported ec key size: %d", bits)
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", keyType)
+}
+
+// createCSR returns a PEM encoded CSR for key, with the names from req
+func createCSR(key crypto.Signer, req issuedCert) (string, error) {
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: req.CommonName},
+		DNSNames: req.AltNames,
+	}
+
+	for _, ip := range req.IPSANs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return "", fmt.Errorf("invalid IP SAN: %s", ip)
+		}
+		template.IPAddresses = append(template.IPAddresses, parsed)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// encodePrivateKey returns key in the same PEM format vault uses
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+	}
+
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// caChain returns the full CA chain for a cert, falling back to the issuing
+// CA if vault didn't send a chain
+func caChain(creds *TLSCredentialResp) string {
+	chain := strings.Join(creds.CAChain, "\n")
+
+	if chain == "" {
+		chain = creds.IssuingCA
+	}
+
+	return chain
+}
+
+// certExpiry returns when a PEM encoded cert expires
+func certExpiry(certPEM string) (time.Time, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotAfter, nil
+}
+
+// checkCertFiles makes sure a cert can be written to files, which it can't
+// if any of them already exist and force isn't set. Check before issuing
+// the cert, so we don't end up with one nobody can use
+func checkCertFiles(files map[string]string, force bool) error {
+	if force {
+		return nil
+	}
+
+	for _, path := range files {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use --force to replace it", path)
+		}
+	}
+
+	return nil
+}
+
+// writeCertFiles writes the parts of a cert to the files they're keyed by.
+// Existing files are only replaced if force is set, and nothing is written
+// if any of them exist
+func writeCertFiles(files map[string]string, creds *TLSCredentialResp, p12Password string, force bool) error {
+	if err := checkCertFiles(files, force); err != nil {
+		return err
+	}
+
+	for kind, path := range files {
+		var err error
+
+		switch kind {
+		case "cert":
+			err = writeCertFile(path, creds.Cert, 0644, force)
+		case "key":
+			err = writeCertFile(path, creds.PrivateKey, 0600, force)
+		case "ca":
+			err = writeCertFile(path, caChain(creds), 0644, force)
+		case "bundle":
+			bundle := strings.Join([]string{strings.TrimSpace(creds.PrivateKey), strings.TrimSpace(creds.Cert), caChain(creds)}, "\n")
+			err = writeCertFile(path, bundle, 0600, force)
+		case "p12":
+			err = writePKCS12(path, creds, p12Password, force)
+		default:
+			err = fmt.Errorf("unknown cert file type: %s", kind)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceCertFiles writes a new cert over an existing one. Everything is
+// written next to the old files first and then renamed into place, so no
+// file is ever half written. The files are renamed one at a time, so a
+// reader can briefly see the new cert next to the old key. If a rename
+// fails the old files are put back, so they're never left mismatched
+func replaceCertFiles(files map[string]string, creds *TLSCredentialResp, p12Password string) error {
+	tmpFiles := map[string]string{}
+	for kind, path := range files {
+		tmpFiles[kind] = path + ".breakglass-new"
+	}
+
+	if err := writeCertFiles(tmpFiles, creds, p12Password, true); err != nil {
+		removeCertFiles(tmpFiles)
+		return err
+	}
+
+	// keep a link to each old file until all the new ones are in place
+	oldFiles := map[string]string{}
+	var replaced []string
+	var err error
+
+	for kind, path := range files {
+		if _, statErr := os.Stat(path); statErr == nil {
+			old := path + ".breakglass-old"
+			os.Remove(old)
+
+			if err = os.Link(path, old); err != nil {
+				break
+			}
+			oldFiles[kind] = old
+		}
+
+		if err = os.Rename(tmpFiles[kind], path); err != nil {
+			break
+		}
+		replaced = append(replaced, kind)
+	}
+
+	if err != nil {
+		for _, kind := range replaced {
+			if old, ok := oldFiles[kind]; ok {
+				os.Rename(old, files[kind])
+			} else {
+				os.Remove(files[kind])
+			}
+		}
+		removeCertFiles(tmpFiles)
+	}
+
+	removeCertFiles(oldFiles)
+
+	return err
+}
+
+// removeCertFiles removes the files that haven't already been moved away
+func removeCertFiles(files map[string]string) {
+	for _, path := range files {
+		os.Remove(path)
+	}
+}
+
+// writeCertFile writes a PEM file, refusing to replace an existing file
+// unless force is set
+func writeCertFile(path string, data string, perm os.FileMode, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(path, flags, perm)
+
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists, use --force to replace it", path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// make sure an existing file gets the right permissions too
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.WriteString(strings.TrimRight(data, "\n") + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// writePKCS12 writes a PKCS#12 bundle with openssl, as there's nothing in
+// the standard library that can create them
+func writePKCS12(path string, creds *TLSCredentialResp, password string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to replace it", path)
+	}
+
+	opensslPath, err := exec.LookPath("openssl")
+
+	if err != nil {
+		return fmt.Errorf("openssl not found in $PATH, can't create a PKCS#12 bundle")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "breakglass-p12")
+
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"key":  filepath.Join(tmpDir, "key.pem"),
+		"cert": filepath.Join(tmpDir, "cert.pem"),
+		"ca":   filepath.Join(tmpDir, "ca.pem"),
+	}
+
+	if err := writeCertFiles(files, creds, "", true); err != nil {
+		return err
+	}
+
+	// pass the password through the environment, so it's not on the command line
+	command := exec.Command(opensslPath, "pkcs12", "-export",
+		"-inkey", files["key"],
+		"-in", files["cert"],
+		"-certfile", files["ca"],
+		"-out", path,
+		"-passout", "env:BREAKGLASS_P12_PASSWORD")
+	command.Env = append(os.Environ(), "BREAKGLASS_P12_PASSWORD="+password)
+
+	if output, err := command.CombinedOutput(); err != nil {
+		return fmt.Errorf("openssl failed: %s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return os.Chmod(path, 0600)
+}
+
+// issuedCertsFile returns where we keep track of the certs we've issued
+func issuedCertsFile() (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".breakglass", "certs.json"), nil
+}
+
+func loadIssuedCerts() ([]issuedCert, error) {
+	var certs []issuedCert
+
+	path, err := issuedCertsFile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &certs); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+func saveIssuedCerts(certs []issuedCert) error {
+	path, err := issuedCertsFile()
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(certs, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// recordIssuedCert adds a cert to the ones we keep track of. A cert written
+// to the same files as an earlier one replaces it
+func recordIssuedCert(cert issuedCert) {
+	certs, err := loadIssuedCerts()
+
+	if err != nil {
+		log.Warn("Not recording issued cert: ", err)
+		return
+	}
+
+	recorded := []issuedCert{cert}
+	for _, c := range certs {
+		if !sameFiles(c.Files, cert.Files) {
+			recorded = append(recorded, c)
+		}
+	}
+
+	if err := saveIssuedCerts(recorded); err != nil {
+		log.Warn("Not recording issued cert: ", err)
+	}
+}
+
+func sameFiles(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
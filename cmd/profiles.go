@@ -0,0 +1,166 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Profile holds the settings for a named target from the config file. Every
+// key apart from backend and inherits is the name of a flag
+type Profile map[string]interface{}
+
+// profilesCmd represents the profiles command
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "Show the profiles defined in the config file",
+	Long: `Profiles are named targets in the config file, which fill in all the flags
+for a backend so you don't have to remember them. Use them with breakglass use <profile>`,
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all profiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		names := profileNames()
+
+		if len(names) == 0 {
+			log.Fatal("No profiles found in config file")
+		}
+
+		for _, name := range names {
+			profile, err := getProfile(name)
+
+			if err != nil {
+				log.Fatal("Error loading profile: ", err)
+			}
+
+			fmt.Printf("%s (%v)\n", name, profile["backend"])
+		}
+	},
+}
+
+var profilesShowCmd = &cobra.Command{
+	Use:   "show <profile>",
+	Short: "Show the settings for a profile, including inherited ones",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			log.Fatal("No profile specified. See --help")
+		}
+
+		profile, err := getProfile(args[0])
+
+		if err != nil {
+			log.Fatal("Error loading profile: ", err)
+		}
+
+		var keys []string
+		for k := range profile {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Printf("%s:\n", args[0])
+		for _, k := range keys {
+			fmt.Printf(" %s: %s\n", k, profileValue(profile[k]))
+		}
+	},
+}
+
+// profileNames returns the names of all the profiles in the config file
+func profileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// getProfile returns the named profile from the config file, with the
+// settings of any profiles it inherits from filled in
+func getProfile(name string) (Profile, error) {
+	return resolveProfile(name, map[string]bool{})
+}
+
+func resolveProfile(name string, seen map[string]bool) (Profile, error) {
+	if seen[name] {
+		return nil, fmt.Errorf("profile %s inherits from itself", name)
+	}
+	seen[name] = true
+
+	raw := viper.GetStringMap("profiles." + name)
+
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("profile %s not found", name)
+	}
+
+	profile := Profile{}
+
+	// start with the settings of the profile we inherit from
+	if parent, ok := raw["inherits"]; ok {
+		inherited, err := resolveProfile(fmt.Sprint(parent), seen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range inherited {
+			profile[k] = v
+		}
+	}
+
+	for k, v := range raw {
+		if k == "inherits" {
+			continue
+		}
+		profile[k] = v
+	}
+
+	return profile, nil
+}
+
+// profileValue converts a setting from the config file into a flag value
+func profileValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return strings.Join(values, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+func init() {
+	RootCmd.AddCommand(profilesCmd)
+	profilesCmd.AddCommand(profilesListCmd)
+	profilesCmd.AddCommand(profilesShowCmd)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var rabbitmqHost string
+var rabbitmqRole string
+var rabbitmqMount string
+var rabbitmqPort int
+var rabbitmqManagementPort int
+var rabbitmqVhost string
+
+type RabbitMQCredentialResp struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// rabbitmqCmd represents the rabbitmq command
+var rabbitmqCmd = &cobra.Command{
+	Use:   "rabbitmq [-- rabbitmqadmin args...]",
+	Short: "Get temporary credentials for RabbitMQ servers",
+	Long: `Generates temporary credentials on a RabbitMQ server and returns a user
+name, password and AMQP URL you can use to connect.
+
+With --exec, or arguments after --, rabbitmqadmin is run with the
+credentials in a temporary config file, so the password isn't on its
+command line. The user is revoked when it exits.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// check specific info
+		if rabbitmqHost == "" {
+			log.Fatal("No RabbitMQ host specified. See --help")
+		}
+
+		if rabbitmqRole == "" {
+			log.Fatal("No RabbitMQ role specified. See --help")
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		rabbitmq, err := readSecret(client, rabbitmqMount+"/creds/"+rabbitmqRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if rabbitmq == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", rabbitmqRole)
+		}
+
+		recordHistory("rabbitmq", rabbitmqHost)
+
+		if wrapped(rabbitmq) {
+			return
+		}
+
+		var response RabbitMQCredentialResp
+
+		if err := mapstructure.Decode(rabbitmq.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running rabbitmqadmin")
+
+			// rabbitmqadmin reads its connection settings from an ini file
+			config := fmt.Sprintf("[breakglass]\nhostname = %s\nport = %d\nusername = %s\npassword = %s\nvhost = %s\n",
+				rabbitmqHost, rabbitmqManagementPort, response.Username, response.Password, rabbitmqVhost)
+
+			configFile, err := writeTempFile("breakglass-rabbitmq", []byte(config))
+
+			if err != nil {
+				log.Fatal("Error writing rabbitmqadmin config: ", err)
+			}
+
+			session := startSession(cleanupTask{LeaseID: rabbitmq.LeaseID, Files: []string{configFile}})
+
+			execSession(client, append([]string{"rabbitmqadmin", "--config", configFile, "--node", "breakglass"}, args...), nil, session)
+		}
+
+		amqpURL := fmt.Sprintf("amqp://%s@%s:%d/%s", url.UserPassword(response.Username, response.Password), rabbitmqHost, rabbitmqPort, url.PathEscape(rabbitmqVhost))
+
+		fmt.Printf("Your RabbitMQ Credentials are below\n username: %s\n password: %s\n url: %s\n", response.Username, response.Password, amqpURL)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rabbitmqCmd)
+
+	rabbitmqCmd.Flags().StringVarP(&rabbitmqHost, "host", "H", "", "RabbitMQ host to connect to")
+	rabbitmqCmd.Flags().StringVarP(&rabbitmqRole, "role", "r", "", "RabbitMQ role to get credentials for")
+	rabbitmqCmd.Flags().StringVarP(&rabbitmqMount, "mount", "", "rabbitmq", "Path the RabbitMQ secrets engine is mounted at")
+	rabbitmqCmd.Flags().IntVarP(&rabbitmqPort, "amqp-port", "", 5672, "Port RabbitMQ listens for AMQP connections on")
+	rabbitmqCmd.Flags().IntVarP(&rabbitmqManagementPort, "management-port", "", 15672, "Port of the RabbitMQ management API, for rabbitmqadmin")
+	rabbitmqCmd.Flags().StringVarP(&rabbitmqVhost, "vhost", "", "/", "Virtual host to connect to")
+}
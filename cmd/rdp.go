@@ -0,0 +1,208 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var rdpHost string
+var rdpPort int
+var rdpSet string
+var rdpKV string
+var rdpUser string
+var rdpDomain string
+
+// rdpCmd represents the rdp command
+var rdpCmd = &cobra.Command{
+	Use:   "rdp",
+	Short: "Get credentials for Windows servers and connect with RDP",
+	Long: `Gets credentials for a Windows server, either by checking out an account
+from an LDAP library set with --set, or from a KV secret with username and
+password fields with --kv.
+
+With --exec, the connection is made with xfreerdp, which is given the
+credentials in a temporary file rather than on its command line. Without
+xfreerdp a temporary .rdp file is opened instead, and the password is
+copied to the clipboard. The temporary file is removed and any checked out
+account is checked back in when you're done.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// check specific info
+		if rdpHost == "" {
+			log.Fatal("No RDP host specified. See --help")
+		}
+
+		if (rdpSet == "") == (rdpKV == "") {
+			log.Fatal("Get the credentials from a library set with --set, or a KV secret with --kv")
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		var session cleanupTask
+		var username, password string
+
+		if rdpSet != "" {
+			mount := viper.GetString("library-mount")
+			secret, account := checkoutAccount(client, mount, rdpSet)
+
+			if secret == nil {
+				return
+			}
+
+			username, password = account.ServiceAccountName, account.Password
+			session = cleanupTask{LibraryMount: mount, LibrarySet: rdpSet, ServiceAccount: username}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go keepLeaseRenewed(client, secret, stop)
+		} else {
+			data := kvGet(client, rdpKV, 0)
+
+			if data == nil {
+				return
+			}
+
+			if u, ok := data["username"]; ok {
+				username = fmt.Sprint(u)
+			}
+			if p, ok := data["password"]; ok {
+				password = fmt.Sprint(p)
+			}
+		}
+
+		if rdpUser != "" {
+			username = rdpUser
+		}
+
+		if username == "" || password == "" {
+			log.Fatal("No username or password found. Use --user if the secret only has a password")
+		}
+
+		recordHistory("rdp", rdpHost)
+
+		if execConn == true {
+			log.Info("Exec enabled, establishing connection")
+			rdpConnect(client, username, password, session)
+			return
+		}
+
+		fmt.Printf("Your RDP Credentials are:\n username: %s\n password: %s\n", username, password)
+
+		// hold on to a checked out account until we're done with it
+		if session.ServiceAccount != "" {
+			session = startSession(session)
+			waitForInterrupt()
+			endSession(client, session)
+		}
+	},
+}
+
+// rdpConnect connects to the host with xfreerdp if it's installed, or the
+// system's RDP client if it's not, then cleans up
+func rdpConnect(client *api.Client, username string, password string, session cleanupTask) {
+	address := fmt.Sprintf("%s:%d", rdpHost, rdpPort)
+
+	xfreerdpPath, err := exec.LookPath("xfreerdp")
+
+	if err == nil {
+		// everything goes in an args file, so the password doesn't show up
+		// in a process listing
+		options := []string{"/v:" + address, "/u:" + username, "/p:" + password}
+		if rdpDomain != "" {
+			options = append(options, "/d:"+rdpDomain)
+		}
+
+		argsFile, err := writeTempFile("breakglass-rdp", []byte(strings.Join(options, "\n")+"\n"))
+
+		if err != nil {
+			log.Fatal("Error writing xfreerdp arguments: ", err)
+		}
+
+		session.Files = append(session.Files, argsFile)
+		session = startSession(session)
+
+		execSession(client, []string{xfreerdpPath, "/args-from:" + argsFile}, nil, session)
+	}
+
+	log.Warn("Note: Install `xfreerdp` to log in automatically")
+
+	settings := []string{
+		"full address:s:" + address,
+		"username:s:" + username,
+		"prompt for credentials:i:1",
+	}
+	if rdpDomain != "" {
+		settings = append(settings, "domain:s:"+rdpDomain)
+	}
+
+	rdpFile, err := writeTempFile("breakglass-*.rdp", []byte(strings.Join(settings, "\r\n")+"\r\n"))
+
+	if err != nil {
+		log.Fatal("Error writing .rdp file: ", err)
+	}
+
+	session.Files = append(session.Files, rdpFile)
+	session = startSession(session)
+
+	if err := copyToClipboard(password); err != nil {
+		log.Warn("Could not copy the password to the clipboard: ", err)
+		log.Info("Password for the session is: ", password)
+	} else {
+		log.Info("The password has been copied to the clipboard")
+	}
+
+	if err := openBrowser(rdpFile); err != nil {
+		log.Warn("Could not open the RDP client: ", err)
+		log.Info("Open ", rdpFile, " to connect")
+	}
+
+	waitForInterrupt()
+	endSession(client, session)
+}
+
+func init() {
+	RootCmd.AddCommand(rdpCmd)
+
+	rdpCmd.Flags().StringVarP(&rdpHost, "host", "H", "", "Windows host to connect to")
+	rdpCmd.Flags().IntVarP(&rdpPort, "rdp-port", "", 3389, "Port RDP listens on")
+	rdpCmd.Flags().StringVarP(&rdpSet, "set", "", "", "LDAP library set to check an account out of")
+	rdpCmd.Flags().StringVarP(&rdpKV, "kv", "", "", "KV secret with the username and password")
+	rdpCmd.Flags().StringVarP(&rdpUser, "user", "u", "", "Username to log in with, instead of the one from vault")
+	rdpCmd.Flags().StringVarP(&rdpDomain, "domain", "d", "", "Windows domain to log in to")
+}
@@ -0,0 +1,123 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var redisHost string
+var redisRole string
+var redisMount string
+var redisPort int
+
+type RedisCredentialResp struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// redisCmd represents the redis command
+var redisCmd = &cobra.Command{
+	Use:   "redis [-- redis-cli args...]",
+	Short: "Get temporary credentials for Redis servers",
+	Long: `Generates temporary credentials on a Redis server, through the database
+secrets engine's redis plugin, and returns a user name, password and URL
+you can use to connect.
+
+With --exec, or arguments after --, redis-cli is run with the password in
+REDISCLI_AUTH, so it isn't on its command line. The user is revoked when
+it exits.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// check specific info
+		if redisHost == "" {
+			log.Fatal("No Redis host specified. See --help")
+		}
+
+		if redisRole == "" {
+			log.Fatal("No Redis role specified. See --help")
+		}
+
+		// get vault client
+		client := getVaultClient()
+
+		redis, err := readSecret(client, redisMount+"/creds/"+redisRole)
+
+		if err != nil {
+			log.Fatal("Error getting credentials: ", err)
+		}
+
+		if redis == nil {
+			log.Fatal("No credentials were retrieved. Check this role exists in vault: ", redisRole)
+		}
+
+		recordHistory("redis", redisHost)
+
+		if wrapped(redis) {
+			return
+		}
+
+		var response RedisCredentialResp
+
+		if err := mapstructure.Decode(redis.Data, &response); err != nil {
+			log.Fatal("Error parsing vault's credential response: ", err)
+		}
+
+		if execConn || len(args) > 0 {
+			log.Info("Exec enabled, running redis-cli")
+
+			session := startSession(cleanupTask{LeaseID: redis.LeaseID})
+
+			execSession(client, append([]string{"redis-cli", "-h", redisHost, "-p", strconv.Itoa(redisPort), "--user", response.Username}, args...), []string{
+				"REDISCLI_AUTH=" + response.Password,
+			}, session)
+		}
+
+		redisURL := fmt.Sprintf("redis://%s@%s:%d", url.UserPassword(response.Username, response.Password), redisHost, redisPort)
+
+		fmt.Printf("Your Redis Credentials are below\n username: %s\n password: %s\n url: %s\n", response.Username, response.Password, redisURL)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(redisCmd)
+
+	redisCmd.Flags().StringVarP(&redisHost, "host", "H", "", "Redis host to connect to")
+	redisCmd.Flags().StringVarP(&redisRole, "role", "r", "", "Database role to get credentials for")
+	redisCmd.Flags().StringVarP(&redisMount, "mount", "", "database", "Path the database secrets engine is mounted at")
+	redisCmd.Flags().IntVarP(&redisPort, "redis-port", "", 6379, "Port Redis listens on")
+}
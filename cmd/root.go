@@ -23,8 +23,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"os/user"
 	"strings"
+	"syscall"
 
 	"github.com/apptio/breakglass/vault"
 	"github.com/bgentry/speakeasy"
@@ -79,10 +81,16 @@ func init() {
 	RootCmd.PersistentFlags().BoolVarP(&debug, "debug", "", false, "enable debug logging")
 	RootCmd.PersistentFlags().BoolVarP(&execConn, "exec", "", false, "Initiate connection with credentials")
 	RootCmd.PersistentFlags().StringVarP(&userName, "username", "", "", "username to authenticate to vault with")
+	RootCmd.PersistentFlags().String("namespace", "", "vault enterprise namespace to use")
+	RootCmd.PersistentFlags().String("wrap-ttl", "", "return a single use wrapping token valid for this long instead of the credentials")
+	RootCmd.PersistentFlags().Duration("approval-timeout", 0, "how long to wait for a control group request to be approved (default is forever)")
 	viper.BindPFlag("vault", RootCmd.PersistentFlags().Lookup("vault"))
 	viper.BindPFlag("username", RootCmd.PersistentFlags().Lookup("username"))
 	viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
 	viper.BindPFlag("exec", RootCmd.PersistentFlags().Lookup("exec"))
+	viper.BindPFlag("namespace", RootCmd.PersistentFlags().Lookup("namespace"))
+	viper.BindPFlag("wrap-ttl", RootCmd.PersistentFlags().Lookup("wrap-ttl"))
+	viper.BindPFlag("approval-timeout", RootCmd.PersistentFlags().Lookup("approval-timeout"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -115,8 +123,20 @@ func initConfig() {
 
 }
 
+// waitForInterrupt blocks until the user hits Ctrl-C, so that credentials
+// can be cleaned up when they're finished with them
+func waitForInterrupt() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	fmt.Println("Press Ctrl-C when finished...")
+	<-c
+}
+
 func getPassword() string {
-	password, _ := speakeasy.Ask("Please enter your password: ")
+	// prompt on stderr, so we don't get mixed up with output that's being captured
+	password, _ := speakeasy.FAsk(os.Stderr, "Please enter your password: ")
 	return strings.TrimSpace(password)
 }
 
@@ -139,11 +159,32 @@ func getVaultClient() *api.Client {
 	userPass = getPassword()
 
 	// create client
-	client, err := vault.New(userName, userPass, authMethod, vaultHost, vaultPort)
+	client, err := vault.New(userName, userPass, authMethod, vaultHost, vaultPort, viper.GetString("namespace"))
 
 	if err != nil {
 		log.Fatal("Error logging into vault: ", err)
 	}
 
+	// finish cleaning up after any sessions that were killed
+	runPendingCleanup(client)
+
+	return client
+}
+
+// getUnauthenticatedClient returns a vault client without logging in, for
+// requests that carry their own token
+func getUnauthenticatedClient() *api.Client {
+	vaultHost = viper.GetString("vault")
+
+	if vaultHost == "" {
+		log.Fatal("No Vault host specified. See --help")
+	}
+
+	client, err := vault.NewClient(vaultHost, vaultPort, viper.GetString("namespace"))
+
+	if err != nil {
+		log.Fatal("Error creating vault client: ", err)
+	}
+
 	return client
 }
@@ -0,0 +1,176 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// startSession saves what needs cleaning up when we're done with a set of
+// credentials, so it can be finished even if we're killed
+func startSession(task cleanupTask) cleanupTask {
+	if !task.empty() {
+		task.ID = saveCleanup(task)
+	}
+
+	return task
+}
+
+// endSession cleans up after a set of credentials: certificates are
+// revoked, temporary files are removed and the vault lease is revoked
+func endSession(client *api.Client, task cleanupTask) {
+	if err := runCleanupTask(client, task); err != nil {
+		log.Fatal("Problem cleaning up: ", err)
+	}
+
+	finishCleanup(task.ID)
+}
+
+// execSession runs a command with credentials in its environment, cleans
+// up after it and exits with the command's exit code
+func execSession(client *api.Client, args []string, env []string, task cleanupTask) {
+	code := runWithEnv(args, env)
+
+	endSession(client, task)
+
+	os.Exit(code)
+}
+
+// the shortest time to wait between lease renewals, so a failing renewal
+// doesn't hammer vault
+const leaseRenewMinWait = 5 * time.Second
+
+// keepLeaseRenewed renews a lease whenever half of it has run out, until
+// stop is closed
+func keepLeaseRenewed(client *api.Client, secret *api.Secret, stop chan struct{}) {
+	if !secret.Renewable {
+		log.Warn("This lease can't be renewed, it expires in ", time.Duration(secret.LeaseDuration)*time.Second)
+		return
+	}
+
+	duration := secret.LeaseDuration
+	for {
+		wait := time.Duration(duration) * time.Second / 2
+		if wait < leaseRenewMinWait {
+			wait = leaseRenewMinWait
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		renewed, err := client.Sys().Renew(secret.LeaseID, 0)
+
+		if err != nil {
+			// try again before it runs out
+			log.Warn("Error renewing vault lease: ", err)
+			duration = duration / 2
+			continue
+		}
+
+		duration = renewed.LeaseDuration
+		log.Debug("Vault lease renewed for ", duration, " seconds")
+	}
+}
+
+// keepTokenRenewed renews our vault token whenever half of its TTL has run
+// out, until stop is closed, for commands that keep using vault long after
+// logging in
+func keepTokenRenewed(client *api.Client, stop chan struct{}) {
+	self, err := client.Auth().Token().LookupSelf()
+
+	if err != nil {
+		log.Error("Could not look up vault token, it won't be renewed: ", err)
+		return
+	}
+
+	var ttl int64
+	if n, ok := self.Data["ttl"].(json.Number); ok {
+		ttl, _ = n.Int64()
+	}
+	renewable, _ := self.Data["renewable"].(bool)
+
+	if ttl == 0 {
+		// root tokens and the like never expire
+		return
+	}
+
+	if !renewable {
+		log.Warn("The vault token can't be renewed, it expires in ", time.Duration(ttl)*time.Second)
+		return
+	}
+
+	for {
+		wait := time.Duration(ttl) * time.Second / 2
+		if wait < leaseRenewMinWait {
+			wait = leaseRenewMinWait
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		renewed, err := client.Auth().Token().RenewSelf(0)
+
+		if err != nil || renewed == nil || renewed.Auth == nil {
+			// try again before it runs out
+			log.Error("Error renewing vault token, vault requests will fail once it expires: ", err)
+			ttl = ttl / 2
+			continue
+		}
+
+		ttl = int64(renewed.Auth.LeaseDuration)
+		log.Debug("Vault token renewed for ", ttl, " seconds")
+	}
+}
+
+// writeTempFile writes credentials to a new file only we can read
+func writeTempFile(prefix string, data []byte) (string, error) {
+	file, err := ioutil.TempFile("", prefix)
+
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
@@ -29,8 +29,8 @@ import (
 	log "github.com/Sirupsen/logrus"
 	//"github.com/acidlemon/go-dumper"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/mapstructure"
-	//"github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -74,10 +74,25 @@ user, which has elevated sudo permissions on Linux machines.`,
 		}
 
 		// check specific info
-		if sshHost == "" {
+		if sshHost == "" && !isInteractive() {
 			log.Fatal("No SSH host specified. See --help")
 		}
 
+		// get vault client
+		client := getVaultClient()
+
+		if sshHost == "" {
+			sshHost, err = pick("ssh", "Select an SSH host", nil, true)
+
+			if err != nil {
+				log.Fatal("No SSH host selected: ", err)
+			}
+
+			if !cmd.Flags().Changed("role") {
+				sshRole = pickSSHRole(client)
+			}
+		}
+
 		log.Debug("ssh host is: ", sshHost)
 
 		//do a reverse DNS lookup to get the IP
@@ -92,57 +107,87 @@ user, which has elevated sudo permissions on Linux machines.`,
 			log.Fatal("Error: returned more than 1 IP - check reverse DNS: ", ip)
 		}
 
-		// get vault client
-		client := getVaultClient()
-
 		options := map[string]interface{}{
 			"ip":       ip[0],
 			"username": sshUser,
 		}
 
-		ssh, err := client.SSHWithMountPoint("ssh").Credential(sshRole, options)
-		//ssh, err := client.Logical().Write("ssh/creds/"+sshRole, options)
+		ssh, err := writeSecret(client, "ssh/creds/"+sshRole, options)
 
 		if err != nil {
 			log.Fatal("Error getting credentials: ", err)
 		}
 
-		// structure for decoding secret
-		var response SSHCredentialResp
+		recordHistory("ssh", sshHost)
 
-		if err := mapstructure.Decode(ssh.Data, &response); err != nil {
-			log.Fatal("Error parsing vault's credential response: ", err)
+		if wrapped(ssh) {
+			return
 		}
 
-		fmt.Printf("Your SSH Credentials are:\n username: %s\n password: %s\n", response.Username, response.Key)
+		sshConnect(ssh)
 
-		if execConn == true {
+	},
+}
 
-			log.Info("Exec enabled, establishing connection")
+// pickSSHRole asks the user which ssh role to use, if they can use more
+// than one
+func pickSSHRole(client *api.Client) string {
+	roles, err := readableRoles(client, "ssh", "creds", "update")
 
-			sshpassPath, err := exec.LookPath("sshpass")
+	if err != nil {
+		log.Fatal("Error listing SSH roles: ", err)
+	}
 
-			if err == nil {
-				// if we're using sshpass, make some assumptions about how we want to make the connection
-				// FIXME: we should probably make this a bit nicer
-				sshCmdArgs = append(sshCmdArgs, []string{"-p", string(response.Key), "ssh", "-o PubkeyAuthentication=no", "-o UserKnownHostsFile=/dev/null", "-o StrictHostKeyChecking=no", response.Username + "@" + string(ip[0])}...)
-				sshCommand = exec.Command(sshpassPath, sshCmdArgs...)
-			} else {
-				sshCmdArgs = append(sshCmdArgs, []string{response.Username + "@" + string(ip[0])}...)
-				sshCommand = exec.Command("ssh", sshCmdArgs...)
-				log.Warn("Note: Install `sshpass` to automate typing in OTP")
-				log.Info("OTP for the session is: ", response.Key)
-			}
-			log.Debug("sshCmd ", sshCommand)
-			sshCommand.Stdin = os.Stdin
-			sshCommand.Stdout = os.Stdout
-			err = sshCommand.Run()
-			if err != nil {
-				log.Fatal("Error creating ssh connection: ", err)
-			}
-		}
+	if len(roles) < 2 {
+		return sshRole
+	}
 
-	},
+	role, err := pick("ssh-role", "Select an SSH role", roles, false)
+
+	if err != nil {
+		log.Fatal("No SSH role selected: ", err)
+	}
+
+	return role
+}
+
+// sshConnect prints the ssh credentials in secret, and connects to the host
+// they were issued for if --exec was given
+func sshConnect(secret *api.Secret) {
+	// structure for decoding secret
+	var response SSHCredentialResp
+
+	if err := mapstructure.Decode(secret.Data, &response); err != nil {
+		log.Fatal("Error parsing vault's credential response: ", err)
+	}
+
+	fmt.Printf("Your SSH Credentials are:\n username: %s\n password: %s\n", response.Username, response.Key)
+
+	if execConn == true {
+
+		log.Info("Exec enabled, establishing connection")
+
+		sshpassPath, err := exec.LookPath("sshpass")
+
+		if err == nil {
+			// if we're using sshpass, make some assumptions about how we want to make the connection
+			// FIXME: we should probably make this a bit nicer
+			sshCmdArgs = append(sshCmdArgs, []string{"-p", string(response.Key), "ssh", "-o PubkeyAuthentication=no", "-o UserKnownHostsFile=/dev/null", "-o StrictHostKeyChecking=no", response.Username + "@" + response.IP}...)
+			sshCommand = exec.Command(sshpassPath, sshCmdArgs...)
+		} else {
+			sshCmdArgs = append(sshCmdArgs, []string{response.Username + "@" + response.IP}...)
+			sshCommand = exec.Command("ssh", sshCmdArgs...)
+			log.Warn("Note: Install `sshpass` to automate typing in OTP")
+			log.Info("OTP for the session is: ", response.Key)
+		}
+		log.Debug("sshCmd ", sshCommand)
+		sshCommand.Stdin = os.Stdin
+		sshCommand.Stdout = os.Stdout
+		err = sshCommand.Run()
+		if err != nil {
+			log.Fatal("Error creating ssh connection: ", err)
+		}
+	}
 }
 
 func init() {
@@ -0,0 +1,84 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// tokenFile returns where we cache the vault token for the vault host
+func tokenFile() (string, error) {
+	homeDir, err := homedir.Dir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".breakglass", "token-"+viper.GetString("vault")), nil
+}
+
+// getCachedVaultClient returns a vault client using the token from a
+// previous login if it's still valid, and logs in otherwise. This is for
+// commands that are run over and over by other tools, where asking for a
+// password every time would be painful
+func getCachedVaultClient() *api.Client {
+	path, err := tokenFile()
+
+	if err != nil {
+		log.Debug("Not using token cache: ", err)
+		return getVaultClient()
+	}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		client := getUnauthenticatedClient()
+		client.SetToken(strings.TrimSpace(string(data)))
+
+		// make sure the token hasn't expired or been revoked
+		if _, err := client.Auth().Token().LookupSelf(); err == nil {
+			log.Debug("Using cached vault token from ", path)
+			return client
+		}
+
+		log.Debug("Cached vault token is no longer valid")
+	}
+
+	client := getVaultClient()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Debug("Not caching vault token: ", err)
+		return client
+	}
+
+	if err := ioutil.WriteFile(path, []byte(client.Token()), 0600); err != nil {
+		log.Debug("Not caching vault token: ", err)
+	}
+
+	return client
+}
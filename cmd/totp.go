@@ -0,0 +1,185 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var totpMount string
+var totpWatch bool
+var totpClip bool
+
+// the TOTP period vault uses unless the key says otherwise
+const totpDefaultPeriod = 30
+
+// totpCmd represents the totp command
+var totpCmd = &cobra.Command{
+	Use:   "totp <key>",
+	Short: "Get a TOTP code from vault's TOTP backend",
+	Long: `Gets the current code for a TOTP key, for vendor consoles that need a
+second factor, and shows how long it has left. With --watch a new code is
+fetched every time it rotates, until you hit Ctrl-C.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No TOTP key specified. See --help")
+		}
+
+		key := args[0]
+
+		// get vault client
+		client := getVaultClient()
+
+		period := totpPeriod(client, key)
+
+		code, ok := totpCode(client, key)
+
+		if !ok {
+			return
+		}
+
+		if totpClip {
+			if err := copyToClipboard(code); err != nil {
+				log.Fatal("Error copying to clipboard: ", err)
+			}
+			log.Info("Copied the code to the clipboard")
+		}
+
+		// scripts only want the code
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 && !totpWatch {
+			fmt.Println(code)
+			return
+		}
+
+		if !totpWatch {
+			fmt.Printf("Your %s code is %s, valid for another %ds\n", key, code, totpRemaining(period))
+			return
+		}
+
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(c)
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		fmt.Println("Press Ctrl-C when finished...")
+
+		for {
+			remaining := totpRemaining(period)
+			fmt.Printf("\r%s  %2ds ", code, remaining)
+
+			select {
+			case <-c:
+				fmt.Println()
+				return
+			case <-ticker.C:
+			}
+
+			// the code has rotated
+			if totpRemaining(period) > remaining {
+				fmt.Println()
+
+				if code, ok = totpCode(client, key); !ok {
+					return
+				}
+			}
+		}
+	},
+}
+
+// totpCode reads the current code for key. It returns false if the code
+// was wrapped for someone else
+func totpCode(client *api.Client, key string) (string, bool) {
+	secret, err := readSecret(client, totpMount+"/code/"+key)
+
+	if err != nil {
+		log.Fatal("Error getting TOTP code: ", err)
+	}
+
+	if secret == nil {
+		log.Fatal("No code was returned. Check the key exists in vault: ", key)
+	}
+
+	if wrapped(secret) {
+		return "", false
+	}
+
+	code, _ := secret.Data["code"].(string)
+
+	return code, true
+}
+
+// totpPeriod returns how often the codes for key rotate. Reading the key
+// needs more access than reading a code, so fall back to vault's default
+func totpPeriod(client *api.Client, key string) int {
+	secret, err := client.Logical().Read(totpMount + "/keys/" + key)
+
+	if err != nil || secret == nil {
+		log.Debug("Could not read TOTP key, assuming a ", totpDefaultPeriod, "s period: ", err)
+		return totpDefaultPeriod
+	}
+
+	switch period := secret.Data["period"].(type) {
+	case json.Number:
+		if n, err := period.Int64(); err == nil && n > 0 {
+			return int(n)
+		}
+	case string:
+		if d, err := time.ParseDuration(period); err == nil && d >= time.Second {
+			return int(d.Seconds())
+		}
+	}
+
+	return totpDefaultPeriod
+}
+
+// totpRemaining returns how many seconds the current code has left
+func totpRemaining(period int) int {
+	return period - int(time.Now().Unix()%int64(period))
+}
+
+func init() {
+	RootCmd.AddCommand(totpCmd)
+
+	totpCmd.Flags().StringVarP(&totpMount, "mount", "", "totp", "Path the TOTP backend is mounted at")
+	totpCmd.Flags().BoolVarP(&totpWatch, "watch", "w", false, "Keep showing the current code as it rotates")
+	totpCmd.Flags().BoolVarP(&totpClip, "clip", "c", false, "Copy the code to the clipboard")
+}
@@ -0,0 +1,139 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// unwrapCmd represents the unwrap command
+var unwrapCmd = &cobra.Command{
+	Use:   "unwrap <token>",
+	Short: "Retrieve credentials from a wrapping token",
+	Long: `Retrieves the credentials someone else fetched for you with --wrap-ttl.
+The wrapping token can only be used once. MySQL and SSH credentials can be
+used to establish a connection straight away with --exec.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// setup debug
+		debug = viper.GetBool("debug")
+		execConn = viper.GetBool("exec")
+
+		if debug == true {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		if len(args) != 1 {
+			log.Fatal("No wrapping token specified. See --help")
+		}
+
+		token := args[0]
+
+		// the wrapping token is all we need to authenticate
+		client := getUnauthenticatedClient()
+
+		// find out what was wrapped before using up the token
+		lookup, err := client.Logical().Write("sys/wrapping/lookup", map[string]interface{}{
+			"token": token,
+		})
+
+		if err != nil {
+			log.Fatal("Error looking up wrapping token: ", err)
+		}
+
+		if lookup == nil {
+			log.Fatal("Wrapping token not found. It may have expired or already been used")
+		}
+
+		path, _ := lookup.Data["creation_path"].(string)
+
+		log.Debug("wrapped path is: ", path)
+
+		client.SetToken(token)
+
+		secret, err := client.Logical().Unwrap("")
+		auditSecret("unwrap", path, secret, err)
+
+		if err != nil {
+			log.Fatal("Error unwrapping credentials: ", err)
+		}
+
+		if secret == nil {
+			log.Fatal("No credentials were found in the wrapping token")
+		}
+
+		parts := strings.Split(path, "/")
+
+		switch {
+		case len(parts) == 4 && parts[0] == "mysql" && parts[2] == "creds":
+			mysqlConnect(parts[1], secret)
+		case len(parts) == 3 && parts[0] == "ssh" && parts[1] == "creds":
+			sshConnect(secret)
+		default:
+			if execConn == true {
+				log.Warn("Don't know how to establish a connection for ", path)
+			}
+			printSecretData(secret)
+		}
+	},
+}
+
+// wrapped prints the wrapping token if the secret was wrapped with
+// --wrap-ttl, and returns true so the caller can stop
+func wrapped(secret *api.Secret) bool {
+	if secret == nil || secret.WrapInfo == nil || viper.GetString("wrap-ttl") == "" {
+		return false
+	}
+
+	fmt.Println("Your credentials have been wrapped. Hand this token to the person who needs them:")
+	fmt.Println(" token: ", secret.WrapInfo.Token)
+	fmt.Println(" ttl:   ", secret.WrapInfo.TTL)
+	fmt.Println("They can retrieve the credentials with: breakglass unwrap <token>")
+
+	return true
+}
+
+// printSecretData prints every field in a secret we don't have a
+// dedicated handler for
+func printSecretData(secret *api.Secret) {
+	var keys []string
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("Your Credentials are below:")
+	for _, k := range keys {
+		fmt.Printf(" %s: %v\n", k, secret.Data[k])
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(unwrapCmd)
+}
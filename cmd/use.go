@@ -0,0 +1,182 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// useCmd represents the use command
+var useCmd = &cobra.Command{
+	Use:   "use <profile> [flags] [-- command args...]",
+	Short: "Get credentials for a profile from the config file",
+	Long: `Runs the backend of a profile from the config file with all of its flags
+filled in. Flags given on the command line take precedence over the profile.
+Flags given before the profile name need to be written as --flag=value.`,
+	// the flags belong to the profile's backend, which we only know once the
+	// profile has been loaded
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, rest := splitProfileArgs(args)
+
+		if name == "" {
+			if len(rest) > 0 && (rest[0] == "-h" || rest[0] == "--help") {
+				cmd.Help()
+				return
+			}
+			log.Fatal("No profile specified. See --help")
+		}
+
+		// the profile has to come from the config file given on the command
+		// line, so load that before looking for it
+		if config := configFileArg(rest); config != "" {
+			cfgFile = config
+			initConfig()
+		}
+
+		profile, err := getProfile(name)
+
+		if err != nil {
+			log.Fatal("Error loading profile: ", err)
+		}
+
+		backend, ok := profile["backend"].(string)
+
+		if !ok || backend == "" {
+			log.Fatal("No backend specified in profile ", name)
+		}
+
+		backendCmd, _, err := RootCmd.Find([]string{backend})
+
+		if err != nil || backendCmd == RootCmd || backendCmd.Run == nil {
+			log.Fatal("Unknown backend in profile ", name, ": ", backend)
+		}
+
+		backendArgs, err := applyProfile(backendCmd, name, profile, rest)
+
+		if err == pflag.ErrHelp {
+			backendCmd.Help()
+			return
+		}
+
+		if err != nil {
+			log.Fatal("Error applying profile: ", err)
+		}
+
+		// or a profile can name the config file the backend uses
+		if RootCmd.PersistentFlags().Lookup("config").Changed {
+			initConfig()
+		}
+
+		backendCmd.Run(backendCmd, backendArgs)
+	},
+}
+
+// splitProfileArgs picks the profile name out of the arguments to use,
+// which is the first one that isn't a flag, and returns the rest
+func splitProfileArgs(args []string) (string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			rest := append([]string{}, args[:i]...)
+			return arg, append(rest, args[i+1:]...)
+		}
+	}
+
+	return "", args
+}
+
+// configFileArg returns the config file given on the command line, if
+// there is one. The flags aren't parsed until the profile is loaded, which
+// needs the config file first
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--config=") {
+			return strings.TrimPrefix(arg, "--config=")
+		}
+
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
+
+// applyProfile parses the flags given on the command line for a profile's
+// backend, then fills in the ones that weren't given from the profile. It
+// returns the backend's arguments
+func applyProfile(backendCmd *cobra.Command, name string, profile Profile, args []string) ([]string, error) {
+	// this also brings in the global flags
+	if err := backendCmd.ParseFlags(args); err != nil {
+		return nil, err
+	}
+
+	for setting, value := range profile {
+		if setting == "backend" {
+			continue
+		}
+
+		// the backend's own flags, then the global ones
+		flag := backendCmd.Flags().Lookup(setting)
+		if flag == nil {
+			flag = backendCmd.PersistentFlags().Lookup(setting)
+		}
+		if flag == nil {
+			flag = RootCmd.PersistentFlags().Lookup(setting)
+		}
+
+		if flag == nil {
+			return nil, fmt.Errorf("unknown setting in profile %s: %s", name, setting)
+		}
+
+		if flag.Changed {
+			continue
+		}
+
+		log.WithFields(log.Fields{"profile": name,
+			"flag": setting}).Debug("setting flag from profile")
+
+		if err := flag.Value.Set(profileValue(value)); err != nil {
+			return nil, fmt.Errorf("invalid value for %s in profile %s: %s", setting, name, err)
+		}
+		flag.Changed = true
+	}
+
+	return backendCmd.Flags().Args(), nil
+}
+
+func init() {
+	RootCmd.AddCommand(useCmd)
+}
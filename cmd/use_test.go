@@ -0,0 +1,137 @@
+// Copyright © 2017 Apptio
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newTestBackend returns a backend command with the flags a profile fills in
+func newTestBackend() *cobra.Command {
+	backend := &cobra.Command{
+		Use: "test-backend",
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	backend.Flags().String("host", "", "")
+	backend.Flags().String("role", "", "")
+
+	return backend
+}
+
+func TestApplyProfile(t *testing.T) {
+	backend := newTestBackend()
+	profile := Profile{"backend": "test-backend", "host": "db-1", "role": "readonly"}
+
+	args, err := applyProfile(backend, "prod-db", profile, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host := backend.Flags().Lookup("host").Value.String(); host != "db-1" {
+		t.Errorf("host = %q, want db-1", host)
+	}
+
+	if role := backend.Flags().Lookup("role").Value.String(); role != "readonly" {
+		t.Errorf("role = %q, want readonly", role)
+	}
+
+	if len(args) != 0 {
+		t.Errorf("args = %v, want none", args)
+	}
+}
+
+func TestApplyProfileOverride(t *testing.T) {
+	backend := newTestBackend()
+	profile := Profile{"backend": "test-backend", "host": "db-1", "role": "readonly"}
+
+	args, err := applyProfile(backend, "prod-db", profile, []string{"--role", "other", "--", "status"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role := backend.Flags().Lookup("role").Value.String(); role != "other" {
+		t.Errorf("role = %q, want the command line's other", role)
+	}
+
+	if host := backend.Flags().Lookup("host").Value.String(); host != "db-1" {
+		t.Errorf("host = %q, want the profile's db-1", host)
+	}
+
+	if !reflect.DeepEqual(args, []string{"status"}) {
+		t.Errorf("args = %v, want [status]", args)
+	}
+}
+
+func TestApplyProfileUnknownSetting(t *testing.T) {
+	backend := newTestBackend()
+	profile := Profile{"backend": "test-backend", "no-such-flag": "x"}
+
+	if _, err := applyProfile(backend, "prod-db", profile, nil); err == nil {
+		t.Error("expected an error for a setting with no flag")
+	}
+}
+
+func TestSplitProfileArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		profile string
+		rest    []string
+	}{
+		{[]string{"prod-db"}, "prod-db", []string{}},
+		{[]string{"prod-db", "--role", "other"}, "prod-db", []string{"--role", "other"}},
+		{[]string{"--debug", "prod-db", "-r", "other"}, "prod-db", []string{"--debug", "-r", "other"}},
+		{[]string{"--", "prod-db"}, "", []string{"--", "prod-db"}},
+		{nil, "", nil},
+	}
+
+	for _, test := range tests {
+		profile, rest := splitProfileArgs(test.args)
+
+		if profile != test.profile || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("splitProfileArgs(%v) = %q, %v, want %q, %v", test.args, profile, rest, test.profile, test.rest)
+		}
+	}
+}
+
+func TestConfigFileArg(t *testing.T) {
+	tests := []struct {
+		args   []string
+		config string
+	}{
+		{[]string{"--config=/etc/bg.yaml"}, "/etc/bg.yaml"},
+		{[]string{"--role", "other", "--config", "/etc/bg.yaml"}, "/etc/bg.yaml"},
+		{[]string{"--config"}, ""},
+		{[]string{"--", "--config", "/etc/bg.yaml"}, ""},
+		{[]string{"--role", "other"}, ""},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		if config := configFileArg(test.args); config != test.config {
+			t.Errorf("configFileArg(%v) = %q, want %q", test.args, config, test.config)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"fmt"
+	"net/http"
 
 	log "github.com/Sirupsen/logrus"
 	//"github.com/acidlemon/go-dumper"
@@ -12,23 +13,9 @@ const (
 	apiVersion = "v1"
 )
 
-func New(username string, password string, method string, host string, port int) (*api.Client, error) {
+func New(username string, password string, method string, host string, port int, namespace string) (*api.Client, error) {
 
-	// create the login URL
-	url := fmt.Sprintf("https://%s:%v", host, port)
-
-	log.Debug("Using Vault URL: ", url)
-
-	// vault API config
-	config := &api.Config{Address: url}
-
-	// read environment variables
-	if err := config.ReadEnvironment(); err != nil {
-		log.Warn("Error reading environment variables", err)
-	}
-
-	// create a new client
-	client, err := api.NewClient(config)
+	client, err := NewClient(host, port, namespace)
 
 	if err != nil {
 		log.Fatal("Error creating vault client", err)
@@ -62,3 +49,44 @@ func New(username string, password string, method string, host string, port int)
 	return client, nil
 
 }
+
+// NewClient returns a vault client that has not logged in yet. If namespace
+// is set, every request is made inside that vault enterprise namespace
+func NewClient(host string, port int, namespace string) (*api.Client, error) {
+
+	// create the login URL
+	url := fmt.Sprintf("https://%s:%v", host, port)
+
+	log.Debug("Using Vault URL: ", url)
+
+	// vault API config
+	config := api.DefaultConfig()
+	config.Address = url
+
+	// read environment variables
+	if err := config.ReadEnvironment(); err != nil {
+		log.Warn("Error reading environment variables", err)
+	}
+
+	if namespace != "" {
+		log.Debug("Using Vault namespace: ", namespace)
+		config.HttpClient.Transport = &namespaceTransport{
+			namespace: namespace,
+			transport: config.HttpClient.Transport,
+		}
+	}
+
+	// create a new client
+	return api.NewClient(config)
+}
+
+// namespaceTransport adds the vault namespace header to every request
+type namespaceTransport struct {
+	namespace string
+	transport http.RoundTripper
+}
+
+func (t *namespaceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Vault-Namespace", t.namespace)
+	return t.transport.RoundTrip(req)
+}